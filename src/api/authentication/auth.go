@@ -2,10 +2,11 @@ package authentication
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/IWannaCommunity/gate-jump/src/api/res"
-	"github.com/IWannaCommunity/gate-jump/src/api/settings"
 	jwt "github.com/dgrijalva/jwt-go"
 )
 
@@ -20,6 +21,13 @@ const (
 	SERVER    Level = 4  // server can update any user without giving 2 shits
 )
 
+// PassportScope is the scope seeded by the migrations that's trusted with managing the service
+const PassportScope = "passport"
+
+// UsersScope is the scope seeded by the migrations that lets an application acting as itself
+// manage users the way an admin does
+const UsersScope = "users"
+
 type Context struct {
 	Claims Claims
 	Token  string
@@ -28,44 +36,182 @@ type Context struct {
 type Claims struct {
 	ID       int64   `json:"id"`
 	Name     *string `json:"username"`
-	Admin    bool    `json:"admin"`
+	Admin    bool    `json:"admin"` // holds the passport scope
 	Country  *string `json:"country"`
 	Locale   *string `json:"locale"`
 	Verified bool    `json:"verified"`
 	Banned   bool    `json:"banned"`
+	Scope    string  `json:"scope,omitempty"`     // space separated, the user's scopes or what an application was granted
+	Session  int64   `json:"sid,omitempty"`       // the login the token was issued under
+	Client   string  `json:"client_id,omitempty"` // set instead of ID when an application acts as itself
+	jwt.StandardClaims
+}
+
+// IDClaims are the claims of an OpenID Connect id_token, and the body of /userinfo
+type IDClaims struct {
+	Name          *string `json:"preferred_username,omitempty"`
+	Email         *string `json:"email,omitempty"`
+	EmailVerified *bool   `json:"email_verified,omitempty"`
+	Locale        *string `json:"locale,omitempty"`
+	Nonce         string  `json:"nonce,omitempty"`
 	jwt.StandardClaims
 }
 
+// HasScope reports if scope is one of the space separated scopes in scopes
+func HasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IntersectScopes keeps the scopes in scopes that are also in allowed
+func IntersectScopes(scopes, allowed string) string {
+	kept := []string{}
+	for _, s := range strings.Fields(scopes) {
+		if HasScope(allowed, s) && !HasScope(strings.Join(kept, " "), s) {
+			kept = append(kept, s)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// UnionScopes combines two lists of space separated scopes without repeating any
+func UnionScopes(a, b string) string {
+	return IntersectScopes(a+" "+b, a+" "+b)
+}
+
+// RequireScope only lets a request through if its token holds the given scope
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, _ := r.Context().Value(CLAIMS).(Context) // JWTContext has to run first
+
+			if ctx.Claims.ID == 0 && ctx.Claims.Client == "" {
+				res.New(http.StatusUnauthorized).SetErrorMessage("Login Required").Error(w)
+				return
+			}
+			if ctx.Claims.Banned {
+				res.New(http.StatusForbidden).SetErrorMessage("Account Banned").Error(w)
+				return
+			}
+			if ctx.Claims.Audience != "" { // an application signed in as the user is never let at the service's routes
+				res.New(http.StatusForbidden).SetErrorMessage("Invalid Permissions").Error(w)
+				return
+			}
+			if !HasScope(ctx.Claims.Scope, scope) {
+				res.New(http.StatusForbidden).SetErrorMessage("Invalid Permissions").Error(w)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SessionStore tells us if the login a token was issued under is still signed in
+type SessionStore interface {
+	SessionActive(id int64) (bool, error)
+}
+
+var sessions SessionStore
+
+// SetSessionStore has JWTContext reject tokens whose login was revoked
+func SetSessionStore(store SessionStore) {
+	sessions = store
+}
+
+// the reasons ParseToken turns a token away, anything else it returns is our own failure
+var (
+	ErrTokenUnreadable = errors.New("Invalid Token Provided")
+	ErrTokenInvalid    = errors.New("Token Is Invalid")
+	ErrSessionRevoked  = errors.New("Session Revoked")
+	ErrTokenRevoked    = errors.New("Token Revoked")
+)
+
+// checks a token was signed by us and hasn't expired
+func verifyToken(tokenString string) (Claims, error) {
+	var claims Claims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, keyFunc)
+	if err != nil { // token couldn't be read
+		return claims, ErrTokenUnreadable
+	}
+	if !token.Valid { // token has been edited
+		return claims, ErrTokenInvalid
+	}
+	return claims, nil
+}
+
+// PeekToken reads a token that was signed by us and hasn't expired without asking the database
+// if it was signed out, so who it's from can be trusted but not that it still works
+func PeekToken(tokenString string) (Claims, bool) {
+	claims, err := verifyToken(tokenString)
+	return claims, err == nil
+}
+
+// ParseToken checks a token was signed by us, hasn't expired and hasn't been signed out
+func ParseToken(tokenString string) (Claims, error) {
+	claims, err := verifyToken(tokenString)
+	if err != nil {
+		return claims, err
+	}
+
+	if claims.Session != 0 && sessions != nil {
+		active, err := sessions.SessionActive(claims.Session)
+		if err != nil {
+			return claims, err
+		}
+		if !active { // they were signed out remotely
+			return claims, ErrSessionRevoked
+		}
+	}
+
+	if claims.Id != "" {
+		revoked, err := IsRevoked(claims.Id)
+		if err != nil {
+			return claims, err
+		}
+		if revoked { // signed out, or the account changed under it
+			return claims, ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+// BearerToken is the token the request was sent with, empty if there isn't one
+func BearerToken(r *http.Request) string {
+	tokenString := r.Header.Get("Authorization")
+	if strings.HasPrefix(tokenString, "Basic ") { // client credentials, not ours to check
+		return ""
+	}
+	return strings.TrimPrefix(tokenString, "Bearer ")
+}
+
 func JWTContext(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		contextData := Context{}
-		tokenString := r.Header.Get("Authorization")
+		tokenString := BearerToken(r)
 
 		if tokenString == "" { // no token provided. public credential only
 			ctx := context.WithValue(r.Context(), CLAIMS, Context{Claims: Claims{ID: 0}})
 			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
-		// parse token provided
-		token, err := jwt.ParseWithClaims(tokenString, &contextData.Claims,
-			func(token *jwt.Token) (interface{}, error) {
-				return []byte(settings.JwtSecret), nil
-			})
-		if err != nil { // token couldn't be read
-			res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Token Provided").Error(w)
-			return
-		}
-		if !token.Valid { // token has been edited
-			res.New(http.StatusUnauthorized).SetErrorMessage("Token Is Invalid").Error(w)
+		claims, err := ParseToken(tokenString)
+		switch err {
+		case nil:
+		case ErrTokenUnreadable, ErrTokenInvalid, ErrSessionRevoked, ErrTokenRevoked:
+			res.New(http.StatusUnauthorized).SetErrorMessage(err.Error()).Error(w)
 			return
-		}
-
-		if token.Claims == nil { // nothing was put into the token
-			res.New(http.StatusInternalServerError).SetErrorMessage("Token Is Null").Error(w)
+		default:
+			res.New(http.StatusInternalServerError).SetInternalError(&res.ServerError{Err: err}).Error(w)
 			return
 		}
 		contextData.Token = tokenString
-		contextData.Claims = *token.Claims.(*Claims)
+		contextData.Claims = claims
 
 		ctx := context.WithValue(r.Context(), CLAIMS, contextData)
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -0,0 +1,100 @@
+package authentication
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// serves a request through JWTContext and RequireScope, returning the status code
+func serveScoped(t *testing.T, scope string, claims *Claims) int {
+	handler := JWTContext(RequireScope(scope)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if claims != nil {
+		signed, err := Sign(claims)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		r.Header.Set("Authorization", "Bearer "+signed)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestRequireScope(t *testing.T) {
+	resetKeyring("ES256")
+	expires := jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()}
+
+	assert.Equal(t, http.StatusUnauthorized, serveScoped(t, PassportScope, nil))
+	assert.Equal(t, http.StatusForbidden, serveScoped(t, PassportScope, &Claims{ID: 1, Scope: "openid profile", StandardClaims: expires}))
+	assert.Equal(t, http.StatusForbidden, serveScoped(t, PassportScope, &Claims{ID: 1, Scope: "passport", Banned: true, StandardClaims: expires}))
+	assert.Equal(t, http.StatusOK, serveScoped(t, PassportScope, &Claims{ID: 1, Scope: "openid passport", StandardClaims: expires}))
+
+	granted := jwt.StandardClaims{Audience: "test_client", ExpiresAt: expires.ExpiresAt}
+	assert.Equal(t, http.StatusForbidden, serveScoped(t, PassportScope, &Claims{ID: 1, Scope: "openid passport", StandardClaims: granted}))
+}
+
+type memoryRevocations map[string]bool
+
+func (m memoryRevocations) TokenRevoked(id string) (bool, error) { return m[id], nil }
+func (m memoryRevocations) RevokeToken(id string) error          { m[id] = true; return nil }
+func (m memoryRevocations) PurgeExpiredTokens() error            { return nil }
+func (m memoryRevocations) RevokeUserTokens(userID int64) ([]RevokedToken, error) {
+	return nil, nil
+}
+func (m memoryRevocations) RevokeClientTokens(appID int64) ([]RevokedToken, error) {
+	return nil, nil
+}
+
+func TestRevokedTokenIsRejected(t *testing.T) {
+	resetKeyring("ES256")
+	store := memoryRevocations{}
+	SetRevocationStore(store)
+	defer SetRevocationStore(nil)
+
+	claims := &Claims{ID: 1, Scope: "passport", StandardClaims: jwt.StandardClaims{Id: "abc", ExpiresAt: time.Now().Add(time.Hour).Unix()}}
+	assert.Equal(t, http.StatusOK, serveScoped(t, PassportScope, claims))
+
+	assert.NoError(t, Revoke(RevokedToken{ID: "abc", Expires: time.Now().Add(time.Hour)}))
+	assert.True(t, store["abc"])
+	assert.Equal(t, http.StatusUnauthorized, serveScoped(t, PassportScope, claims))
+}
+
+func TestScopeLists(t *testing.T) {
+	assert.Equal(t, "openid email", IntersectScopes("openid passport email", "email openid profile"))
+	assert.Equal(t, "", IntersectScopes("passport", "openid"))
+	assert.Equal(t, "openid", IntersectScopes("openid openid", "openid"))
+	assert.Equal(t, "openid email profile", UnionScopes("openid email", "email profile"))
+	assert.Equal(t, "profile", UnionScopes("", "profile"))
+}
+
+func TestParseToken(t *testing.T) {
+	resetKeyring("ES256")
+	store := memoryRevocations{"gone": true}
+	SetRevocationStore(store)
+	defer SetRevocationStore(nil)
+
+	_, err := ParseToken("not a token")
+	assert.Equal(t, ErrTokenUnreadable, err)
+
+	expires := time.Now().Add(time.Hour).Unix()
+	signed, err := Sign(&Claims{ID: 1, StandardClaims: jwt.StandardClaims{Id: "gone", ExpiresAt: expires}})
+	assert.NoError(t, err)
+	_, err = ParseToken(signed)
+	assert.Equal(t, ErrTokenRevoked, err)
+
+	signed, err = Sign(&Claims{ID: 1, Scope: "openid", StandardClaims: jwt.StandardClaims{Id: "kept", ExpiresAt: expires}})
+	assert.NoError(t, err)
+	claims, err := ParseToken(signed)
+	assert.NoError(t, err)
+	assert.Equal(t, "openid", claims.Scope)
+}
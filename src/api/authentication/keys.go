@@ -0,0 +1,286 @@
+package authentication
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/log"
+	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// how long a retired key keeps verifying tokens, longer than anything we sign lives for
+	keyGracePeriod = time.Hour * 24
+	// how often the daemon checks if the current key is due for rotation
+	keyCheckInterval = time.Hour
+	// how often an unknown kid is allowed to make us reload keys from the store
+	keyReloadInterval = time.Minute
+)
+
+// SigningKey is a private key tokens are signed with, published in the jwks by its ID
+type SigningKey struct {
+	ID        string
+	Algorithm string // RS256 or ES256
+	Private   crypto.Signer
+	Created   time.Time
+	Retires   time.Time // stops signing new tokens
+	Expires   time.Time // stops verifying, every token it signed has expired by now
+}
+
+// KeyStore persists signing keys so every instance of the service signs with the same ones
+type KeyStore interface {
+	LoadKeys() ([]SigningKey, error)
+	SaveKey(key SigningKey) error
+	DeleteKey(id string) error
+}
+
+// JSONWebKey is the public half of a signing key as laid out by RFC 7517
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is the body of /.well-known/jwks.json
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+var keyring struct {
+	sync.RWMutex
+	keys       []SigningKey
+	store      KeyStore
+	lastReload time.Time
+}
+
+// InitKeys loads the signing keys from the store, creating one if there isn't a usable key yet
+func InitKeys(store KeyStore) error {
+	keyring.Lock()
+	keyring.store = store
+	keyring.Unlock()
+
+	return RotateKeys()
+}
+
+// KeyDaemon rotates the signing keys on schedule
+func KeyDaemon() {
+	for range time.Tick(keyCheckInterval) {
+		if err := RotateKeys(); err != nil {
+			log.Error("Could not rotate signing keys, %v", err)
+		}
+	}
+}
+
+// RotateKeys drops keys that have fully expired and creates a new one once the current one retires
+func RotateKeys() error {
+	keyring.Lock()
+	defer keyring.Unlock()
+
+	now := time.Now()
+
+	// another instance may have rotated before us
+	if keyring.store != nil {
+		keys, err := keyring.store.LoadKeys()
+		if err != nil {
+			return err
+		}
+		keyring.keys = keys
+		keyring.lastReload = now
+	}
+
+	kept := []SigningKey{}
+	for _, key := range keyring.keys {
+		if now.After(key.Expires) {
+			if keyring.store != nil {
+				if err := keyring.store.DeleteKey(key.ID); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		kept = append(kept, key)
+	}
+	keyring.keys = kept
+
+	if _, ok := activeKey(now); ok {
+		return nil
+	}
+
+	key, err := NewSigningKey(settings.Keys.Algorithm, now)
+	if err != nil {
+		return err
+	}
+	if keyring.store != nil {
+		if err := keyring.store.SaveKey(key); err != nil {
+			return err
+		}
+	}
+	keyring.keys = append(keyring.keys, key)
+
+	log.Info("Rotated in new signing key ", key.ID)
+	return nil
+}
+
+// NewSigningKey generates a signing key for the given algorithm, it is not added to the keyring
+func NewSigningKey(algorithm string, now time.Time) (SigningKey, error) {
+	var err error
+	key := SigningKey{Algorithm: algorithm, Created: now}
+
+	if key.ID, err = util.CreateSecureString(16); err != nil {
+		return key, err
+	}
+
+	switch algorithm {
+	case "ES256":
+		key.Private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "RS256":
+		key.Private, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		err = errors.New("unsupported signing algorithm " + algorithm)
+	}
+	if err != nil {
+		return key, err
+	}
+
+	key.Retires = now.Add(settings.Keys.Rotation)
+	key.Expires = key.Retires.Add(keyGracePeriod)
+	return key, nil
+}
+
+// the newest key that hasn't retired yet, the keyring must be locked by the caller
+func activeKey(now time.Time) (SigningKey, bool) {
+	var active SigningKey
+	found := false
+	for _, key := range keyring.keys {
+		if now.Before(key.Retires) && (!found || key.Created.After(active.Created)) {
+			active = key
+			found = true
+		}
+	}
+	return active, found
+}
+
+// Sign signs the claims with the active key, putting its id in the kid header
+func Sign(claims jwt.Claims) (string, error) {
+	keyring.RLock()
+	key, ok := activeKey(time.Now())
+	keyring.RUnlock()
+
+	if !ok { // the daemon hasn't gotten to it yet, or keys were never initialized
+		if err := RotateKeys(); err != nil {
+			return "", err
+		}
+		keyring.RLock()
+		key, ok = activeKey(time.Now())
+		keyring.RUnlock()
+		if !ok {
+			return "", errors.New("no signing key available")
+		}
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// finds an unexpired key by id, reloading from the store if we haven't heard of it
+func findKey(id string) (SigningKey, bool) {
+	find := func() (SigningKey, bool) {
+		now := time.Now()
+		for _, key := range keyring.keys {
+			if key.ID == id && now.Before(key.Expires) {
+				return key, true
+			}
+		}
+		return SigningKey{}, false
+	}
+
+	keyring.RLock()
+	key, ok := find()
+	stale := keyring.store != nil && time.Since(keyring.lastReload) > keyReloadInterval
+	keyring.RUnlock()
+	if ok || !stale {
+		return key, ok
+	}
+
+	keyring.Lock()
+	defer keyring.Unlock()
+	if keys, err := keyring.store.LoadKeys(); err != nil {
+		log.Error("Could not reload signing keys, %v", err)
+	} else {
+		keyring.keys = keys
+	}
+	keyring.lastReload = time.Now()
+	return find()
+}
+
+// keyFunc hands jwt-go the public key matching the token's kid
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+	key, ok := findKey(id)
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Algorithm { // don't let the token pick how it gets verified
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.Private.Public(), nil
+}
+
+// JWKS returns the public halves of every key that can still verify a token
+func JWKS() JSONWebKeySet {
+	keyring.RLock()
+	defer keyring.RUnlock()
+
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	now := time.Now()
+	for _, key := range keyring.keys {
+		if now.After(key.Expires) {
+			continue
+		}
+
+		jwk := JSONWebKey{Use: "sig", Algorithm: key.Algorithm, KeyID: key.ID}
+		switch public := key.Private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (public.Curve.Params().BitSize + 7) / 8
+			jwk.KeyType = "EC"
+			jwk.Curve = public.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(padBytes(public.X.Bytes(), size))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(padBytes(public.Y.Bytes(), size))
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// coordinates have to be the full size of the curve, big.Int drops leading zeros
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
@@ -0,0 +1,97 @@
+package authentication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// start every test off with an empty in memory keyring
+func resetKeyring(algorithm string) {
+	settings.Keys.Algorithm = algorithm
+	settings.Keys.Rotation = time.Hour * 24
+	keyring.keys = nil
+	keyring.store = nil
+}
+
+func parse(token string) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(token, &Claims{}, keyFunc)
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, algorithm := range []string{"ES256", "RS256"} {
+		resetKeyring(algorithm)
+
+		signed, err := Sign(Claims{ID: 1, StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()}})
+		if !assert.NoError(t, err, algorithm) {
+			continue
+		}
+
+		token, err := parse(signed)
+		if assert.NoError(t, err, algorithm) {
+			assert.True(t, token.Valid, algorithm)
+			assert.Equal(t, algorithm, token.Method.Alg())
+			assert.Equal(t, int64(1), token.Claims.(*Claims).ID)
+		}
+
+		jwks := JWKS()
+		if assert.Len(t, jwks.Keys, 1, algorithm) {
+			assert.Equal(t, token.Header["kid"], jwks.Keys[0].KeyID)
+			assert.Equal(t, algorithm, jwks.Keys[0].Algorithm)
+		}
+	}
+}
+
+func TestRetiredKeyStillVerifies(t *testing.T) {
+	resetKeyring("ES256")
+
+	old, err := Sign(Claims{ID: 1})
+	assert.NoError(t, err)
+
+	keyring.keys[0].Retires = time.Now().Add(-time.Minute)
+	assert.NoError(t, RotateKeys())
+
+	fresh, err := Sign(Claims{ID: 1})
+	assert.NoError(t, err)
+
+	oldToken, err := parse(old)
+	assert.NoError(t, err)
+	freshToken, err := parse(fresh)
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, oldToken.Header["kid"], freshToken.Header["kid"])
+	assert.Len(t, JWKS().Keys, 2)
+}
+
+func TestExpiredKeyIsDropped(t *testing.T) {
+	resetKeyring("ES256")
+
+	old, err := Sign(Claims{ID: 1})
+	assert.NoError(t, err)
+
+	keyring.keys[0].Retires = time.Now().Add(-time.Hour)
+	keyring.keys[0].Expires = time.Now().Add(-time.Minute)
+	assert.NoError(t, RotateKeys())
+
+	_, err = parse(old)
+	assert.Error(t, err)
+	assert.Len(t, JWKS().Keys, 1)
+}
+
+func TestSigningMethodIsPinned(t *testing.T) {
+	resetKeyring("ES256")
+	_, err := Sign(Claims{ID: 1})
+	assert.NoError(t, err)
+
+	// a token claiming to be HS256 signed with one of our key ids shouldn't get anywhere
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{ID: 1})
+	forged.Header["kid"] = keyring.keys[0].ID
+	signed, err := forged.SignedString([]byte(""))
+	assert.NoError(t, err)
+
+	_, err = parse(signed)
+	assert.Error(t, err)
+}
@@ -0,0 +1,167 @@
+package authentication
+
+import (
+	"sync"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/log"
+)
+
+const (
+	// how long we trust that a token isn't revoked before asking the store again, this is
+	// how long a revocation made by another instance of the service can take to be noticed
+	unrevokedCacheTime = time.Minute
+	// how long we remember a revocation we didn't make ourselves, longer than anything we sign lives for
+	revokedCacheTime = time.Hour * 24
+	// how often the daemon clears out tokens that expired on their own
+	revocationSweepInterval = time.Hour
+)
+
+// RevokedToken is a token id along with when the token would have expired anyway
+type RevokedToken struct {
+	ID      string
+	Expires time.Time
+}
+
+// RevocationStore persists which tokens have been revoked
+type RevocationStore interface {
+	TokenRevoked(id string) (bool, error)
+	RevokeToken(id string) error
+	RevokeUserTokens(userID int64) ([]RevokedToken, error)
+	RevokeClientTokens(appID int64) ([]RevokedToken, error)
+	PurgeExpiredTokens() error
+}
+
+type revocationEntry struct {
+	revoked bool
+	until   time.Time
+}
+
+var revocations struct {
+	sync.Mutex
+	store RevocationStore
+	cache map[string]revocationEntry
+}
+
+// SetRevocationStore has JWTContext reject tokens that have been revoked
+func SetRevocationStore(store RevocationStore) {
+	revocations.Lock()
+	defer revocations.Unlock()
+
+	revocations.store = store
+	revocations.cache = make(map[string]revocationEntry)
+}
+
+// RevocationDaemon keeps the revocation list from growing forever
+func RevocationDaemon() {
+	for range time.Tick(revocationSweepInterval) {
+		revocations.Lock()
+		now := time.Now()
+		for id, entry := range revocations.cache {
+			if now.After(entry.until) {
+				delete(revocations.cache, id)
+			}
+		}
+		store := revocations.store
+		revocations.Unlock()
+
+		if store != nil {
+			if err := store.PurgeExpiredTokens(); err != nil {
+				log.Error("Could not purge expired tokens, %v", err)
+			}
+		}
+	}
+}
+
+// IsRevoked reports if the token with the given id has been revoked
+func IsRevoked(id string) (bool, error) {
+	revocations.Lock()
+	store := revocations.store
+	entry, ok := revocations.cache[id]
+	revocations.Unlock()
+
+	if store == nil {
+		return false, nil
+	}
+	if ok && time.Now().Before(entry.until) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := store.TokenRevoked(id)
+	if err != nil {
+		return false, err
+	}
+
+	until := time.Now().Add(unrevokedCacheTime)
+	if revoked { // nothing unrevokes a token
+		until = time.Now().Add(revokedCacheTime)
+	}
+	cacheRevocation(id, revoked, until)
+
+	return revoked, nil
+}
+
+// Revoke revokes a single token
+func Revoke(token RevokedToken) error {
+	revocations.Lock()
+	store := revocations.store
+	revocations.Unlock()
+
+	if store != nil {
+		if err := store.RevokeToken(token.ID); err != nil {
+			return err
+		}
+	}
+	cacheRevocation(token.ID, true, token.Expires)
+	return nil
+}
+
+// RevokeUser revokes every token the user has outstanding
+func RevokeUser(userID int64) error {
+	revocations.Lock()
+	store := revocations.store
+	revocations.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	tokens, err := store.RevokeUserTokens(userID)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		cacheRevocation(token.ID, true, token.Expires)
+	}
+	return nil
+}
+
+// RevokeClient revokes every client credentials token the application has outstanding
+func RevokeClient(appID int64) error {
+	revocations.Lock()
+	store := revocations.store
+	revocations.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	tokens, err := store.RevokeClientTokens(appID)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		cacheRevocation(token.ID, true, token.Expires)
+	}
+	return nil
+}
+
+func cacheRevocation(id string, revoked bool, until time.Time) {
+	revocations.Lock()
+	defer revocations.Unlock()
+
+	if revocations.cache == nil {
+		revocations.cache = make(map[string]revocationEntry)
+	}
+	revocations.cache[id] = revocationEntry{revoked: revoked, until: until}
+}
@@ -0,0 +1,221 @@
+package authentication
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/log"
+)
+
+const (
+	// failures allowed before we start making them wait between attempts
+	throttleFreeAttempts = 3
+	// the first wait, it doubles with every failure after that
+	throttleBaseDelay = time.Second
+	// failures before an account is locked, any number of addresses can add to it
+	accountLockoutThreshold = 10
+	// failures before an address is locked, it's higher since one address can be many people
+	ipLockoutThreshold = 50
+	// how long without a failure before the count starts over
+	attemptWindow = time.Hour
+	// how often the daemon clears out counts that have started over
+	attemptSweepInterval = time.Minute * 10
+)
+
+// LockoutDuration is how long an account or an address stays locked
+const LockoutDuration = time.Minute * 15
+
+// Attempts is the count of failed logins for an account or an address
+type Attempts struct {
+	Failures    int
+	Last        time.Time
+	LockedUntil time.Time
+}
+
+// AttemptStore persists failed login counts, keyed by account or by address
+type AttemptStore interface {
+	GetAttempts(key string) (Attempts, error)
+	// UpdateAttempts replaces the count for key with what update makes of it and returns the
+	// result, nothing else can change the count in between
+	UpdateAttempts(key string, update func(Attempts) Attempts) (Attempts, error)
+	ClearAttempts(key string) error
+	PurgeAttempts(before time.Time) error
+}
+
+// MemoryAttemptStore keeps failed login counts in memory, they're forgotten on restart and aren't
+// shared between instances of the service
+type MemoryAttemptStore struct {
+	sync.Mutex
+	attempts map[string]Attempts
+}
+
+// NewMemoryAttemptStore makes an empty MemoryAttemptStore
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: make(map[string]Attempts)}
+}
+
+func (m *MemoryAttemptStore) GetAttempts(key string) (Attempts, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.attempts[key], nil
+}
+
+func (m *MemoryAttemptStore) UpdateAttempts(key string, update func(Attempts) Attempts) (Attempts, error) {
+	m.Lock()
+	defer m.Unlock()
+	attempts := update(m.attempts[key])
+	m.attempts[key] = attempts
+	return attempts, nil
+}
+
+func (m *MemoryAttemptStore) ClearAttempts(key string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.attempts, key)
+	return nil
+}
+
+// PurgeAttempts forgets counts whose last failure was before the given time and aren't locked
+func (m *MemoryAttemptStore) PurgeAttempts(before time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	for key, attempts := range m.attempts {
+		if attempts.Last.Before(before) && attempts.LockedUntil.Before(before) {
+			delete(m.attempts, key)
+		}
+	}
+	return nil
+}
+
+var throttle struct {
+	sync.Mutex
+	store AttemptStore
+}
+
+// SetAttemptStore changes where failed login counts are kept, they're kept in memory until this is called
+func SetAttemptStore(store AttemptStore) {
+	throttle.Lock()
+	defer throttle.Unlock()
+	throttle.store = store
+}
+
+func attemptStore() AttemptStore {
+	throttle.Lock()
+	defer throttle.Unlock()
+	if throttle.store == nil {
+		throttle.store = NewMemoryAttemptStore()
+	}
+	return throttle.store
+}
+
+// ThrottleDaemon keeps the failed login counts from growing forever
+func ThrottleDaemon() {
+	for range time.Tick(attemptSweepInterval) {
+		if err := attemptStore().PurgeAttempts(time.Now().Add(-attemptWindow)); err != nil {
+			log.Error("Could not purge failed login counts, %v", err)
+		}
+	}
+}
+
+// counts are kept by the name that was tried, whether or not anyone has it, so a missing account
+// is throttled the same as a real one
+func accountKey(account string) string {
+	return "account:" + strings.ToLower(account)
+}
+
+func ipKey(ip net.IP) string {
+	return "ip:" + ip.String()
+}
+
+// reads the count for key, a count that's gone quiet for long enough starts over
+func currentAttempts(store AttemptStore, key string, now time.Time) (Attempts, error) {
+	attempts, err := store.GetAttempts(key)
+	if err != nil {
+		return attempts, err
+	}
+	return attempts.current(now), nil
+}
+
+// the count as of now, one that's gone quiet for long enough starts over
+func (a Attempts) current(now time.Time) Attempts {
+	if now.Sub(a.Last) > attemptWindow && !now.Before(a.LockedUntil) {
+		return Attempts{}
+	}
+	return a
+}
+
+// how long after the last failure the next attempt has to wait
+func (a Attempts) wait(now time.Time) time.Duration {
+	if now.Before(a.LockedUntil) {
+		return a.LockedUntil.Sub(now)
+	}
+	if a.Failures < throttleFreeAttempts {
+		return 0
+	}
+
+	delay := LockoutDuration
+	if shift := uint(a.Failures - throttleFreeAttempts); shift < 16 && throttleBaseDelay<<shift < LockoutDuration {
+		delay = throttleBaseDelay << shift
+	}
+	if wait := a.Last.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// LoginWait reports how long a login to account from ip has to wait, zero if it can go ahead now
+func LoginWait(account string, ip net.IP, now time.Time) (time.Duration, error) {
+	store := attemptStore()
+
+	var longest time.Duration
+	for _, key := range []string{accountKey(account), ipKey(ip)} {
+		attempts, err := currentAttempts(store, key, now)
+		if err != nil {
+			return 0, err
+		}
+		if wait := attempts.wait(now); wait > longest {
+			longest = wait
+		}
+	}
+	return longest, nil
+}
+
+// LoginFailed counts a failed login to account from ip, reporting if it just got the account locked
+func LoginFailed(account string, ip net.IP, now time.Time) (bool, error) {
+	store := attemptStore()
+
+	var locked bool
+	for _, key := range []string{accountKey(account), ipKey(ip)} {
+		threshold := ipLockoutThreshold
+		if key == accountKey(account) {
+			threshold = accountLockoutThreshold
+		}
+
+		// counted in one go, so failures at the same time can't overwrite each other
+		attempts, err := store.UpdateAttempts(key, func(attempts Attempts) Attempts {
+			attempts = attempts.current(now)
+			attempts.Failures++
+			attempts.Last = now
+			// locks again every threshold failures, so it can't be waited out and guessed at forever
+			if attempts.Failures%threshold == 0 {
+				attempts.LockedUntil = now.Add(LockoutDuration)
+			}
+			return attempts
+		})
+		if err != nil {
+			return false, err
+		}
+		if attempts.Failures%threshold == 0 && key == accountKey(account) {
+			locked = true
+		}
+	}
+	return locked, nil
+}
+
+// LoginSucceeded starts the account's count over. the address's count is left alone, otherwise
+// signing in to an account of your own would let you keep guessing at others
+func LoginSucceeded(account string) error {
+	return attemptStore().ClearAttempts(accountKey(account))
+}
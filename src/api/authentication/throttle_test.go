@@ -0,0 +1,143 @@
+package authentication
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fails a login n times, a second apart, returning when the last one was
+func failLogins(t *testing.T, account string, ip net.IP, start time.Time, n int) time.Time {
+	now := start
+	for i := 0; i < n; i++ {
+		now = now.Add(time.Second)
+		_, err := LoginFailed(account, ip, now)
+		assert.NoError(t, err)
+	}
+	return now
+}
+
+func TestLoginBackoff(t *testing.T) {
+	SetAttemptStore(NewMemoryAttemptStore())
+	defer SetAttemptStore(nil)
+	ip := net.ParseIP("192.0.2.1")
+	start := time.Now()
+
+	now := failLogins(t, "kid", ip, start, throttleFreeAttempts-1)
+	wait, err := LoginWait("kid", ip, now)
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+
+	// the wait doubles with every failure past the free ones
+	now = failLogins(t, "kid", ip, now, 1)
+	wait, _ = LoginWait("kid", ip, now)
+	assert.Equal(t, throttleBaseDelay, wait)
+	now = failLogins(t, "kid", ip, now, 2)
+	wait, _ = LoginWait("kid", ip, now)
+	assert.Equal(t, throttleBaseDelay*4, wait)
+
+	wait, _ = LoginWait("kid", ip, now.Add(throttleBaseDelay*4))
+	assert.Zero(t, wait)
+
+	// names are counted however they're typed, and whether or not anyone has them
+	wait, _ = LoginWait("KID", net.ParseIP("192.0.2.2"), now)
+	assert.Equal(t, throttleBaseDelay*4, wait)
+
+	// signing in starts the account over
+	assert.NoError(t, LoginSucceeded("Kid"))
+	wait, _ = LoginWait("kid", net.ParseIP("192.0.2.2"), now)
+	assert.Zero(t, wait)
+}
+
+func TestAccountLockout(t *testing.T) {
+	SetAttemptStore(NewMemoryAttemptStore())
+	defer SetAttemptStore(nil)
+	start := time.Now()
+
+	// spread over addresses so only the account's count gets anywhere
+	now := start
+	for i := 1; i <= accountLockoutThreshold; i++ {
+		now = now.Add(time.Second)
+		locked, err := LoginFailed("kid", net.IPv4(192, 0, 2, byte(i)), now)
+		assert.NoError(t, err)
+		assert.Equal(t, i == accountLockoutThreshold, locked)
+	}
+
+	wait, _ := LoginWait("kid", net.ParseIP("198.51.100.1"), now)
+	assert.Equal(t, LockoutDuration, wait)
+	wait, _ = LoginWait("kid", net.ParseIP("198.51.100.1"), now.Add(LockoutDuration))
+	assert.Zero(t, wait)
+
+	// another account from the same addresses is fine
+	wait, _ = LoginWait("someone else", net.IPv4(192, 0, 2, 1), now)
+	assert.Zero(t, wait)
+}
+
+func TestIPLockout(t *testing.T) {
+	SetAttemptStore(NewMemoryAttemptStore())
+	defer SetAttemptStore(nil)
+	ip := net.ParseIP("2001:db8::1")
+	start := time.Now()
+
+	// a different account every time, like a password spray
+	now := start
+	for i := 0; i < ipLockoutThreshold; i++ {
+		now = now.Add(time.Second)
+		locked, err := LoginFailed(string(rune('a'+i%26))+string(rune('a'+i/26)), ip, now)
+		assert.NoError(t, err)
+		assert.False(t, locked)
+	}
+
+	wait, _ := LoginWait("a fresh account", ip, now)
+	assert.Equal(t, LockoutDuration, wait)
+	wait, _ = LoginWait("a fresh account", net.ParseIP("2001:db8::2"), now)
+	assert.Zero(t, wait)
+}
+
+func TestAttemptsStartOver(t *testing.T) {
+	store := NewMemoryAttemptStore()
+	SetAttemptStore(store)
+	defer SetAttemptStore(nil)
+	ip := net.ParseIP("192.0.2.1")
+	start := time.Now()
+
+	now := failLogins(t, "kid", ip, start, throttleFreeAttempts+2)
+	later := now.Add(attemptWindow + time.Second)
+	wait, _ := LoginWait("kid", ip, later)
+	assert.Zero(t, wait)
+
+	// one more failure after the window is the first of a new count
+	failLogins(t, "kid", ip, later, 1)
+	attempts, _ := store.GetAttempts(accountKey("kid"))
+	assert.Equal(t, 1, attempts.Failures)
+
+	assert.NoError(t, store.PurgeAttempts(later.Add(attemptWindow)))
+	assert.Empty(t, store.attempts)
+}
+
+func TestConcurrentFailuresAllCount(t *testing.T) {
+	store := NewMemoryAttemptStore()
+	SetAttemptStore(store)
+	defer SetAttemptStore(nil)
+	ip := net.ParseIP("192.0.2.1")
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < accountLockoutThreshold; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := LoginFailed("kid", ip, now)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	attempts, _ := store.GetAttempts(accountKey("kid"))
+	assert.Equal(t, accountLockoutThreshold, attempts.Failures)
+	wait, _ := LoginWait("kid", ip, now)
+	assert.Equal(t, LockoutDuration, wait)
+}
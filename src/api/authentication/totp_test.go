@@ -0,0 +1,66 @@
+package authentication
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the sha1 vectors of RFC 6238, cut down to our 6 digits
+func TestTOTPCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, expected := range vectors {
+		code, err := TOTPCode(secret, time.Unix(unix, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code, "at %d", unix)
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	assert.NoError(t, err)
+
+	now := time.Now()
+	code, _ := TOTPCode(secret, now)
+
+	step, ok := VerifyTOTP(secret, code, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, totpStep(now), step)
+
+	// a little drift is fine, a lot isn't
+	_, ok = VerifyTOTP(secret, code, now.Add(totpPeriod*time.Second), 0)
+	assert.True(t, ok)
+	_, ok = VerifyTOTP(secret, code, now.Add(3*totpPeriod*time.Second), 0)
+	assert.False(t, ok)
+
+	// used codes can't be used again
+	_, ok = VerifyTOTP(secret, code, now, step)
+	assert.False(t, ok)
+
+	_, ok = VerifyTOTP(secret, "12345", now, 0)
+	assert.False(t, ok)
+	_, ok = VerifyTOTP("not base32!", code, now, 0)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("gate-jump", "kid", "ABCDEF"))
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/gate-jump:kid", uri.Path)
+	assert.Equal(t, "ABCDEF", uri.Query().Get("secret"))
+	assert.Equal(t, "gate-jump", uri.Query().Get("issuer"))
+}
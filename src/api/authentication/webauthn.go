@@ -0,0 +1,332 @@
+package authentication
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// authenticator data flags, as laid out by the webauthn spec
+const (
+	authDataUserPresent  = 0x01
+	authDataUserVerified = 0x04
+	authDataAttested     = 0x40
+	authDataExtensions   = 0x80
+)
+
+// the COSE algorithms we can verify, ES256 and RS256 are what every authenticator supports
+const (
+	COSEAlgES256 = -7
+	COSEAlgRS256 = -257
+)
+
+// everything that can be wrong with a credential, worded for handing back to the client
+var (
+	ErrCredentialMalformed  = errors.New("Malformed Credential")
+	ErrCredentialChallenge  = errors.New("Challenge Mismatch")
+	ErrCredentialOrigin     = errors.New("Origin Mismatch")
+	ErrCredentialRelying    = errors.New("Relying Party Mismatch")
+	ErrCredentialPresence   = errors.New("User Not Present")
+	ErrCredentialVerified   = errors.New("User Not Verified")
+	ErrCredentialAlgorithm  = errors.New("Unsupported Key Algorithm")
+	ErrCredentialSignature  = errors.New("Invalid Signature")
+	ErrCredentialSignCount  = errors.New("Credential Possibly Cloned")
+	ErrCredentialIDMismatch = errors.New("Credential ID Mismatch")
+)
+
+// RelyingParty is us as far as authenticators are concerned, credentials are bound to the ID and
+// are only accepted from pages on the Origin
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// PublicKeyCredential is what navigator.credentials hands the page, with every buffer base64url
+// encoded. registrations fill in AttestationObject, logins fill in the rest
+type PublicKeyCredential struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject,omitempty"`
+		AuthenticatorData string `json:"authenticatorData,omitempty"`
+		Signature         string `json:"signature,omitempty"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// WebAuthnKey is a credential an authenticator registered with us
+type WebAuthnKey struct {
+	CredentialID []byte
+	PublicKey    []byte // COSE encoded
+	SignCount    uint32
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+// DecodeBase64URL reads the base64url the browser sends buffers as, padded or not
+func DecodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// NewWebAuthnChallenge makes a random challenge for a registration or login
+func NewWebAuthnChallenge() (string, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(challenge), nil
+}
+
+// CredentialChallenge reads the challenge the credential was made for, so it can be looked up.
+// nothing about the credential has been checked yet
+func CredentialChallenge(cred PublicKeyCredential) (string, error) {
+	raw, err := DecodeBase64URL(cred.Response.ClientDataJSON)
+	if err != nil {
+		return "", ErrCredentialMalformed
+	}
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil || cd.Challenge == "" {
+		return "", ErrCredentialMalformed
+	}
+	return cd.Challenge, nil
+}
+
+// checks the client data is from the right ceremony, for our challenge, on our page
+func (rp RelyingParty) checkClientData(raw []byte, ceremony, challenge string) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return ErrCredentialMalformed
+	}
+	if cd.Type != ceremony {
+		return ErrCredentialMalformed
+	}
+	if subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(challenge)) != 1 {
+		return ErrCredentialChallenge
+	}
+	if cd.Origin != rp.Origin {
+		return ErrCredentialOrigin
+	}
+	return nil
+}
+
+// reads authenticator data and checks it was made for us with the user there
+func (rp RelyingParty) parseAuthData(raw []byte, requireVerified bool) (authenticatorData, error) {
+	var ad authenticatorData
+	if len(raw) < 37 {
+		return ad, ErrCredentialMalformed
+	}
+	ad.RPIDHash = raw[:32]
+	ad.Flags = raw[32]
+	ad.SignCount = binary.BigEndian.Uint32(raw[33:37])
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.RPIDHash, rpIDHash[:]) {
+		return ad, ErrCredentialRelying
+	}
+	if ad.Flags&authDataUserPresent == 0 {
+		return ad, ErrCredentialPresence
+	}
+	if requireVerified && ad.Flags&authDataUserVerified == 0 {
+		return ad, ErrCredentialVerified
+	}
+
+	if ad.Flags&authDataAttested != 0 {
+		rest := raw[37:]
+		if len(rest) < 18 { // aaguid and the credential id length
+			return ad, ErrCredentialMalformed
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLength {
+			return ad, ErrCredentialMalformed
+		}
+		ad.CredentialID, rest = rest[:idLength], rest[idLength:]
+
+		// the key is cbor, extensions can follow it so it has to be read to know where it stops
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return ad, ErrCredentialMalformed
+		}
+		ad.PublicKey = rest[:len(rest)-len(after)]
+		if len(after) > 0 && ad.Flags&authDataExtensions == 0 {
+			return ad, ErrCredentialMalformed
+		}
+	}
+	return ad, nil
+}
+
+// reads a COSE key, only ES256 on P-256 and RS256 are supported
+func parseCOSEKey(raw []byte) (crypto.PublicKey, int64, error) {
+	decoded, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, 0, ErrCredentialMalformed
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, ErrCredentialMalformed
+	}
+
+	alg, _ := key[int64(3)].(int64)
+	switch alg {
+	case COSEAlgES256:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if key[int64(1)] != int64(2) || crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, ErrCredentialMalformed
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, 0, ErrCredentialMalformed
+		}
+		return pub, alg, nil
+	case COSEAlgRS256:
+		n, _ := key[int64(-1)].([]byte)
+		e, _ := key[int64(-2)].([]byte)
+		if key[int64(1)] != int64(3) || len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, 0, ErrCredentialMalformed
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, alg, nil
+	}
+	return nil, 0, ErrCredentialAlgorithm
+}
+
+// checks sig is the key's signature over data
+func verifyCOSESignature(publicKey []byte, data, sig []byte) error {
+	pub, alg, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(data)
+
+	switch alg {
+	case COSEAlgES256:
+		var parsed struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(sig, &parsed); err != nil || len(rest) > 0 {
+			return ErrCredentialSignature
+		}
+		if !ecdsa.Verify(pub.(*ecdsa.PublicKey), hash[:], parsed.R, parsed.S) {
+			return ErrCredentialSignature
+		}
+	case COSEAlgRS256:
+		if rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, hash[:], sig) != nil {
+			return ErrCredentialSignature
+		}
+	}
+	return nil
+}
+
+// VerifyRegistration checks a newly made credential and returns its key. we ask for no
+// attestation, so whatever statement came with it isn't checked and the key is trusted as is
+func (rp RelyingParty) VerifyRegistration(cred PublicKeyCredential, challenge string, requireVerified bool) (WebAuthnKey, error) {
+	var key WebAuthnKey
+
+	rawClientData, err := DecodeBase64URL(cred.Response.ClientDataJSON)
+	if err != nil {
+		return key, ErrCredentialMalformed
+	}
+	if err := rp.checkClientData(rawClientData, "webauthn.create", challenge); err != nil {
+		return key, err
+	}
+
+	rawAttestation, err := DecodeBase64URL(cred.Response.AttestationObject)
+	if err != nil {
+		return key, ErrCredentialMalformed
+	}
+	decoded, _, err := decodeCBOR(rawAttestation)
+	if err != nil {
+		return key, ErrCredentialMalformed
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return key, ErrCredentialMalformed
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return key, ErrCredentialMalformed
+	}
+
+	ad, err := rp.parseAuthData(rawAuthData, requireVerified)
+	if err != nil {
+		return key, err
+	}
+	if ad.Flags&authDataAttested == 0 {
+		return key, ErrCredentialMalformed
+	}
+
+	id, err := DecodeBase64URL(cred.ID)
+	if err != nil || !bytes.Equal(id, ad.CredentialID) {
+		return key, ErrCredentialIDMismatch
+	}
+	if _, _, err := parseCOSEKey(ad.PublicKey); err != nil {
+		return key, err
+	}
+
+	key.CredentialID = ad.CredentialID
+	key.PublicKey = ad.PublicKey
+	key.SignCount = ad.SignCount
+	return key, nil
+}
+
+// VerifyAssertion checks a login made with a registered credential, returning the signature
+// counter to store for next time
+func (rp RelyingParty) VerifyAssertion(cred PublicKeyCredential, challenge string, key WebAuthnKey, requireVerified bool) (uint32, error) {
+	rawClientData, err := DecodeBase64URL(cred.Response.ClientDataJSON)
+	if err != nil {
+		return 0, ErrCredentialMalformed
+	}
+	if err := rp.checkClientData(rawClientData, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	rawAuthData, err := DecodeBase64URL(cred.Response.AuthenticatorData)
+	if err != nil {
+		return 0, ErrCredentialMalformed
+	}
+	ad, err := rp.parseAuthData(rawAuthData, requireVerified)
+	if err != nil {
+		return 0, err
+	}
+
+	sig, err := DecodeBase64URL(cred.Response.Signature)
+	if err != nil {
+		return 0, ErrCredentialMalformed
+	}
+	clientDataHash := sha256.Sum256(rawClientData)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if err := verifyCOSESignature(key.PublicKey, signed, sig); err != nil {
+		return 0, err
+	}
+
+	// authenticators that count only ever go up, going back means there's a copy of the key
+	if (ad.SignCount != 0 || key.SignCount != 0) && ad.SignCount <= key.SignCount {
+		return 0, ErrCredentialSignCount
+	}
+	return ad.SignCount, nil
+}
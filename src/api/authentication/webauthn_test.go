@@ -0,0 +1,228 @@
+package authentication
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeCBOR is just enough of an encoder for the software authenticator below
+func encodeCBOR(v interface{}) []byte {
+	head := func(major byte, arg uint64) []byte {
+		switch {
+		case arg < 24:
+			return []byte{major<<5 | byte(arg)}
+		case arg < 1<<8:
+			return []byte{major<<5 | 24, byte(arg)}
+		default:
+			b := []byte{major<<5 | 25, 0, 0}
+			binary.BigEndian.PutUint16(b[1:], uint16(arg))
+			return b
+		}
+	}
+
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case map[interface{}]interface{}:
+		keys := []string{}
+		encoded := map[string][]byte{}
+		for k, item := range v {
+			key := string(encodeCBOR(k))
+			keys = append(keys, key)
+			encoded[key] = encodeCBOR(item)
+		}
+		sort.Strings(keys)
+		out := head(5, uint64(len(v)))
+		for _, key := range keys {
+			out = append(append(out, key...), encoded[key]...)
+		}
+		return out
+	}
+	panic("can't encode")
+}
+
+// softAuthenticator is a passkey that lives in memory
+type softAuthenticator struct {
+	key   *ecdsa.PrivateKey
+	id    []byte
+	count uint32
+	flags byte
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	return &softAuthenticator{key: key, id: []byte("soft-credential-1"), flags: authDataUserPresent | authDataUserVerified}
+}
+
+func (a *softAuthenticator) clientData(ceremony, challenge, origin string) []byte {
+	cd, _ := json.Marshal(clientData{Type: ceremony, Challenge: challenge, Origin: origin})
+	return cd
+}
+
+func (a *softAuthenticator) authData(rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	ad := append([]byte{}, rpIDHash[:]...)
+	flags := a.flags
+	if attested {
+		flags |= authDataAttested
+	}
+	ad = append(ad, flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(ad[33:], a.count)
+
+	if attested {
+		ad = append(ad, make([]byte, 16)...) // aaguid
+		ad = append(ad, byte(len(a.id)>>8), byte(len(a.id)))
+		ad = append(ad, a.id...)
+		ad = append(ad, encodeCBOR(map[interface{}]interface{}{
+			1:  2,
+			3:  COSEAlgES256,
+			-1: 1,
+			-2: padTo(a.key.X.Bytes(), 32),
+			-3: padTo(a.key.Y.Bytes(), 32),
+		})...)
+	}
+	return ad
+}
+
+func padTo(b []byte, n int) []byte {
+	return append(make([]byte, n-len(b)), b...)
+}
+
+func (a *softAuthenticator) register(rpID, origin, challenge string) PublicKeyCredential {
+	var cred PublicKeyCredential
+	cred.ID = base64.RawURLEncoding.EncodeToString(a.id)
+	cred.Type = "public-key"
+	cred.Response.ClientDataJSON = base64.RawURLEncoding.EncodeToString(a.clientData("webauthn.create", challenge, origin))
+	cred.Response.AttestationObject = base64.RawURLEncoding.EncodeToString(encodeCBOR(map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": a.authData(rpID, true),
+	}))
+	return cred
+}
+
+func (a *softAuthenticator) login(rpID, origin, challenge string) PublicKeyCredential {
+	a.count++
+	cd := a.clientData("webauthn.get", challenge, origin)
+	ad := a.authData(rpID, false)
+	cdHash := sha256.Sum256(cd)
+	digest := sha256.Sum256(append(append([]byte{}, ad...), cdHash[:]...))
+
+	r, s, _ := ecdsa.Sign(rand.Reader, a.key, digest[:])
+	sig, _ := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+
+	var cred PublicKeyCredential
+	cred.ID = base64.RawURLEncoding.EncodeToString(a.id)
+	cred.Type = "public-key"
+	cred.Response.ClientDataJSON = base64.RawURLEncoding.EncodeToString(cd)
+	cred.Response.AuthenticatorData = base64.RawURLEncoding.EncodeToString(ad)
+	cred.Response.Signature = base64.RawURLEncoding.EncodeToString(sig)
+	return cred
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	rp := RelyingParty{ID: "gate.example.com", Origin: "https://gate.example.com"}
+	a := newSoftAuthenticator(t)
+	challenge, err := NewWebAuthnChallenge()
+	assert.NoError(t, err)
+
+	cred := a.register(rp.ID, rp.Origin, challenge)
+	read, err := CredentialChallenge(cred)
+	assert.NoError(t, err)
+	assert.Equal(t, challenge, read)
+
+	key, err := rp.VerifyRegistration(cred, challenge, true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, a.id, key.CredentialID)
+		assert.NotEmpty(t, key.PublicKey)
+	}
+
+	_, err = rp.VerifyRegistration(cred, "some other challenge", true)
+	assert.Equal(t, ErrCredentialChallenge, err)
+	_, err = rp.VerifyRegistration(a.register(rp.ID, "https://evil.example.com", challenge), challenge, true)
+	assert.Equal(t, ErrCredentialOrigin, err)
+	_, err = rp.VerifyRegistration(a.register("evil.example.com", rp.Origin, challenge), challenge, true)
+	assert.Equal(t, ErrCredentialRelying, err)
+
+	a.flags = authDataUserPresent
+	_, err = rp.VerifyRegistration(a.register(rp.ID, rp.Origin, challenge), challenge, true)
+	assert.Equal(t, ErrCredentialVerified, err)
+	_, err = rp.VerifyRegistration(a.register(rp.ID, rp.Origin, challenge), challenge, false)
+	assert.NoError(t, err)
+}
+
+func TestWebAuthnAssertion(t *testing.T) {
+	rp := RelyingParty{ID: "gate.example.com", Origin: "https://gate.example.com"}
+	a := newSoftAuthenticator(t)
+	challenge, _ := NewWebAuthnChallenge()
+	key, err := rp.VerifyRegistration(a.register(rp.ID, rp.Origin, challenge), challenge, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	challenge, _ = NewWebAuthnChallenge()
+	cred := a.login(rp.ID, rp.Origin, challenge)
+	count, err := rp.VerifyAssertion(cred, challenge, key, true)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), count)
+
+	// the same assertion again looks like a cloned key
+	key.SignCount = count
+	_, err = rp.VerifyAssertion(cred, challenge, key, true)
+	assert.Equal(t, ErrCredentialSignCount, err)
+
+	// somebody else's key
+	other := newSoftAuthenticator(t)
+	other.count = 10
+	_, err = rp.VerifyAssertion(other.login(rp.ID, rp.Origin, challenge), challenge, key, true)
+	assert.Equal(t, ErrCredentialSignature, err)
+
+	// tampered authenticator data
+	cred = a.login(rp.ID, rp.Origin, challenge)
+	ad, _ := DecodeBase64URL(cred.Response.AuthenticatorData)
+	ad[36]++
+	cred.Response.AuthenticatorData = base64.RawURLEncoding.EncodeToString(ad)
+	_, err = rp.VerifyAssertion(cred, challenge, key, true)
+	assert.Equal(t, ErrCredentialSignature, err)
+
+	_, err = rp.VerifyAssertion(a.login(rp.ID, rp.Origin, "stale"), challenge, key, true)
+	assert.Equal(t, ErrCredentialChallenge, err)
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	v, rest, err := decodeCBOR(append(encodeCBOR(map[interface{}]interface{}{"a": -300, 1: []byte{1, 2}}), 0xff))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xff}, rest)
+	assert.Equal(t, map[interface{}]interface{}{"a": int64(-300), int64(1): []byte{1, 2}}, v)
+
+	// lengths past the end, indefinite lengths and nesting bombs are turned away
+	_, _, err = decodeCBOR([]byte{0x59, 0xff, 0xff, 0x00})
+	assert.Error(t, err)
+	_, _, err = decodeCBOR([]byte{0x9f, 0x01, 0xff})
+	assert.Error(t, err)
+	bomb := make([]byte, 100)
+	for i := range bomb {
+		bomb[i] = 0x81
+	}
+	_, _, err = decodeCBOR(bomb)
+	assert.Error(t, err)
+}
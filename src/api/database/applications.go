@@ -0,0 +1,295 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// APPPUBLIC applications can't keep a secret (spas, desktop games) and must use PKCE
+	APPPUBLIC = "public"
+	// APPCONFIDENTIAL applications have a backend that can hold onto a secret
+	APPCONFIDENTIAL = "confidential"
+)
+
+type Application struct {
+	ID int64 `json:"id"`
+	// Read: PUBLIC
+	// Write: Nobody
+	StrID *string `json:"client_id,omitempty"`
+	// Read: PUBLIC
+	// Write: Nobody (generated on creation)
+	Name *string `json:"name,omitempty"`
+	// Read: PUBLIC
+	// Write: ADMIN
+	Description *string `json:"description,omitempty"`
+	// Read: PUBLIC
+	// Write: ADMIN
+	Type *string `json:"type,omitempty"`
+	// Read: PUBLIC
+	// Write: ADMIN (only on creation)
+	Secret *string `json:"secret,omitempty"`
+	// Read: SERVER (plaintext is returned once when created or rotated)
+	// Write: SERVER (hash handled in handler)
+	RedirectURI *string `json:"redirect_uri,omitempty"`
+	// Read: PUBLIC
+	// Write: ADMIN
+	Scopes []string `json:"scopes,omitempty"`
+	// Read: ADMIN (only filled in by GetScopes)
+	// Write: ADMIN (through the application_scopes table)
+}
+
+type ApplicationList struct {
+	StartIndex   int           `json:"startIndex"`             // starting index
+	TotalItems   int           `json:"totalItems"`             // how many items are returned
+	Applications []Application `json:"applications,omitempty"` // application array
+}
+
+// SQL FUNCTIONS =================================================================================
+
+func (a *Application) GetApplication() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "SELECT * FROM applications WHERE id=?"
+	serr.Args = append(serr.Args, a.ID)
+	serr.Err = a.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+	return serr
+}
+
+func (a *Application) GetApplicationByStrID() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "SELECT * FROM applications WHERE str_id=?"
+	serr.Args = append(serr.Args, a.StrID)
+	serr.Err = a.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+	return serr
+}
+
+func (a *Application) CreateApplication() res.ServerError {
+	var serr res.ServerError
+	var result sql.Result
+	serr.Query = "INSERT INTO applications(str_id, name, description, type, secret, redirect_uri) VALUES(?, ?, ?, ?, ?, ?)"
+	serr.Args = append(serr.Args, a.StrID, a.Name, a.Description, a.Type, a.Secret, a.RedirectURI)
+	result, serr.Err = db.Exec(serr.Query, serr.Args...)
+	if serr.Err != nil {
+		return serr
+	}
+	a.ID, _ = result.LastInsertId() // we confirmed that there will be no error
+	return serr
+}
+
+func (a *Application) UpdateApplication() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "UPDATE applications SET"
+
+	if a.Name != nil {
+		serr.Query += " name=?,"
+		serr.Args = append(serr.Args, a.Name)
+	}
+	if a.Description != nil {
+		serr.Query += " description=?,"
+		serr.Args = append(serr.Args, a.Description)
+	}
+	if a.RedirectURI != nil {
+		serr.Query += " redirect_uri=?,"
+		serr.Args = append(serr.Args, a.RedirectURI)
+	}
+	if a.Secret != nil { // hash handled in handler
+		serr.Query += " secret=?,"
+		serr.Args = append(serr.Args, a.Secret)
+	}
+
+	if len(serr.Args) == 0 {
+		return serr // there were no sections to update
+	}
+
+	serr.Query = serr.Query[:len(serr.Query)-1] + " WHERE id=?" // remove last comma of query and add WHERE condition
+	serr.Args = append(serr.Args, a.ID)
+
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+// DeleteApplication removes the application along with its outstanding codes, the logins made
+// through it, its grants and its scopes, all in one transaction so it's never left half deleted
+func (a *Application) DeleteApplication() res.ServerError {
+	var serr res.ServerError
+	var tx *sql.Tx
+
+	if tx, serr.Err = db.Begin(); serr.Err != nil {
+		return serr
+	}
+	defer tx.Rollback() // nothing to undo once it's committed
+
+	// outstanding codes can't be exchanged without their application anyway, and nobody stays
+	// signed in through it
+	for _, table := range []string{"authcodes", "logins", "grants", "application_scopes"} {
+		serr = *new(res.ServerError)
+		serr.Query = "DELETE FROM " + table + " WHERE appid=?"
+		serr.Args = append(serr.Args, a.ID)
+		if _, serr.Err = tx.Exec(serr.Query, serr.Args...); serr.Err != nil {
+			return serr
+		}
+	}
+
+	serr = *new(res.ServerError)
+	serr.Query = "DELETE FROM applications WHERE id=?"
+	serr.Args = append(serr.Args, a.ID)
+	if _, serr.Err = tx.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	serr = *new(res.ServerError)
+	serr.Err = tx.Commit()
+	return serr
+}
+
+func GetApplications(start, count int) (*ApplicationList, res.ServerError) {
+	var serr res.ServerError
+	var rows *sql.Rows
+	serr.Query = "SELECT * FROM applications LIMIT ? OFFSET ?"
+	serr.Args = append(serr.Args, count, start)
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	defer rows.Close()
+
+	apps := []Application{}
+
+	for rows.Next() {
+		var a Application
+		if serr.Err = a.ScanAlls(rows); serr.Err != nil {
+			return nil, serr
+		}
+		a.CleanDataRead()
+		apps = append(apps, a)
+	}
+
+	return &ApplicationList{Applications: apps, StartIndex: start, TotalItems: len(apps)}, serr
+}
+
+// GetScopes fills in the names of the scopes assigned to the application for client credentials
+func (a *Application) GetScopes() res.ServerError {
+	var serr res.ServerError
+	var rows *sql.Rows
+	serr.Query = "SELECT scopes.name FROM application_scopes JOIN scopes ON scopes.id = application_scopes.scopeid WHERE application_scopes.appid=? ORDER BY scopes.name"
+	serr.Args = append(serr.Args, a.ID)
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+
+	if serr.Err != nil {
+		return serr
+	}
+
+	defer rows.Close()
+
+	a.Scopes = []string{}
+
+	for rows.Next() {
+		var scope string
+		if serr.Err = rows.Scan(&scope); serr.Err != nil {
+			return serr
+		}
+		a.Scopes = append(a.Scopes, scope)
+	}
+
+	return serr
+}
+
+// AddScope assigns the scope to the application, doing nothing if it already is
+func (a *Application) AddScope(scopeID int64) res.ServerError {
+	var serr res.ServerError
+	serr.Query = "INSERT IGNORE INTO application_scopes (appid, scopeid) VALUES(?, ?)"
+	serr.Args = append(serr.Args, a.ID, scopeID)
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+func (a *Application) RemoveScope(scopeID int64) res.ServerError {
+	var serr res.ServerError
+	serr.Query = "DELETE FROM application_scopes WHERE appid=? AND scopeid=?"
+	serr.Args = append(serr.Args, a.ID, scopeID)
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+// CreateToken issues a client credentials token, acting as the application itself
+func (a *Application) CreateToken(scope string) (string, error) {
+	jti, err := util.CreateSecureString(32)
+	if err != nil {
+		return "", err
+	}
+	expires := time.Now().Add(TokenLifetime)
+	if err = recordToken(jti, nil, &a.ID, expires); err != nil {
+		return "", err
+	}
+
+	claims := authentication.Claims{
+		Client: *a.StrID,
+		Admin:  authentication.HasScope(scope, authentication.PassportScope),
+		Scope:  scope,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expires.Unix(),
+			Id:        jti,
+			Issuer:    settings.Issuer,
+			Subject:   *a.StrID,
+		},
+	}
+	return authentication.Sign(claims)
+}
+
+// HELPER FUNCTIONS ==============================================================================
+
+// scans all application data into the application struct
+func (a *Application) ScanAll(row *sql.Row) error {
+	return row.Scan(
+		&a.ID,
+		&a.StrID,
+		&a.Name,
+		&a.Description,
+		&a.Type,
+		&a.Secret,
+		&a.RedirectURI)
+}
+
+// scans all application data into the application struct (for rows)
+func (a *Application) ScanAlls(rows *sql.Rows) error {
+	return rows.Scan(
+		&a.ID,
+		&a.StrID,
+		&a.Name,
+		&a.Description,
+		&a.Type,
+		&a.Secret,
+		&a.RedirectURI)
+}
+
+// strips the secret hash, nobody outside of the server has any use for it
+func (a *Application) CleanDataRead() {
+	a.Secret = nil
+}
+
+// IsPublic reports if the application can't be trusted with a secret
+func (a *Application) IsPublic() bool {
+	return a.Type == nil || *a.Type != APPCONFIDENTIAL
+}
+
+// CheckSecret compares a plaintext client secret against the stored hash
+func (a *Application) CheckSecret(secret string) bool {
+	if a.Secret == nil || secret == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(*a.Secret), []byte(secret)) == nil
+}
+
+// CheckRedirectURI confirms a redirect uri is exactly the one that was registered
+func (a *Application) CheckRedirectURI(uri string) bool {
+	return a.RedirectURI != nil && *a.RedirectURI != "" && *a.RedirectURI == uri
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"database/sql"
+	"net"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/log"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+)
+
+// what happened, as recorded in the audit log
+const (
+	AuditRegister      = "register"
+	AuditLogin         = "login"
+	AuditLoginFailed   = "login_failed"
+	AuditLogout        = "logout"
+	AuditRefresh       = "refresh"
+	AuditVerify        = "verify"
+	AuditPasswordReset = "password_reset"
+	AuditEmailChange   = "email_change"
+	AuditUpdate        = "update"
+	AuditBan           = "ban"
+	AuditUnban         = "unban"
+	AuditDelete        = "delete"
+	AuditRestore       = "restore"
+	AuditPurge         = "purge"
+	AuditSessions      = "sessions"
+	AuditTwoFactor     = "two_factor"
+	AuditScope         = "scope"
+	AuditGroup         = "group"
+	AuditApplication   = "application"
+)
+
+// AuditEvent is something security relevant that happened. events are only ever added, the one
+// change made to them is dropping the addresses once the account they're about is erased
+type AuditEvent struct {
+	ID     int64   `json:"id"`
+	Type   string  `json:"type"`
+	Actor  *int64  `json:"actor,omitempty"`  // the user who did it, empty when nobody was signed in
+	Client *string `json:"client,omitempty"` // the application that did it, if one did
+	Target *int64  `json:"target,omitempty"` // the user it was done to
+	IP     net.IP  `json:"ip"`
+	// Detail is what was done, for events where the type doesn't say it all
+	Detail  string    `json:"detail,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// AuditEventList is a page of audit events, newest first
+type AuditEventList struct {
+	StartIndex int          `json:"startIndex"`
+	TotalItems int          `json:"totalItems"`
+	Events     []AuditEvent `json:"events"`
+}
+
+// AuditFilter narrows down GetAuditEvents, empty fields match everything
+type AuditFilter struct {
+	User  *int64 // as the actor or the target
+	Type  string
+	Since *time.Time
+}
+
+// SQL FUNCTIONS =================================================================================
+
+func (e *AuditEvent) CreateAuditEvent() res.ServerError {
+	var serr res.ServerError
+	var result sql.Result
+	err := *new(error)
+
+	e.Created = time.Now()
+	ipv4, ipv6 := splitIP(e.IP)
+	serr.Query = "INSERT INTO audit_events(type, actor, client, target, ipaddrv4, ipaddrv6, detail, created) VALUES(?, ?, ?, ?, ?, ?, ?, ?)"
+	serr.Args = append(serr.Args, e.Type, e.Actor, e.Client, e.Target, ipv4, ipv6, e.Detail, e.Created)
+	if result, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	e.ID, err = result.LastInsertId()
+	if err != nil {
+		log.Wtf(err)
+	}
+	return serr
+}
+
+// GetAuditEvents pages through the events matching filter, newest first
+func GetAuditEvents(filter AuditFilter, start, count int) (*AuditEventList, res.ServerError) {
+	var serr res.ServerError
+	var rows *sql.Rows
+
+	serr.Query = "SELECT * FROM audit_events WHERE TRUE"
+	if filter.User != nil {
+		serr.Query += " AND (actor=? OR target=?)"
+		serr.Args = append(serr.Args, filter.User, filter.User)
+	}
+	if filter.Type != "" {
+		serr.Query += " AND type=?"
+		serr.Args = append(serr.Args, filter.Type)
+	}
+	if filter.Since != nil {
+		serr.Query += " AND created>=?"
+		serr.Args = append(serr.Args, filter.Since)
+	}
+	serr.Query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	serr.Args = append(serr.Args, count, start)
+
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	defer rows.Close()
+
+	events := []AuditEvent{}
+
+	for rows.Next() {
+		var e AuditEvent
+		if serr.Err = e.ScanAlls(rows); serr.Err != nil {
+			return nil, serr
+		}
+		events = append(events, e)
+	}
+
+	return &AuditEventList{StartIndex: start, TotalItems: len(events), Events: events}, serr
+}
+
+// HELPER FUNCTIONS ==============================================================================
+
+// scans all audit event data from a set of rows into the audit event struct
+func (e *AuditEvent) ScanAlls(rows *sql.Rows) error {
+	var ipv4, ipv6 []byte
+	var detail sql.NullString
+
+	err := rows.Scan(
+		&e.ID,
+		&e.Type,
+		&e.Actor,
+		&e.Client,
+		&e.Target,
+		&ipv4,
+		&ipv6,
+		&detail,
+		&e.Created)
+	e.IP = joinIP(ipv4, ipv6)
+	e.Detail = detail.String
+	return err
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/log"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
+)
+
+// AuthCode is a single use authorization code handed out by /oauth/authorize
+type AuthCode struct {
+	ID int64
+	// Code is the plaintext code, only the hash of it is ever stored
+	Code            string
+	AppID           int64
+	UserID          int64
+	RedirectURI     string // as sent to /oauth/authorize, empty when it was left out
+	Scope           *string
+	Challenge       *string
+	ChallengeMethod *string
+	Expires         time.Time
+	Nonce           *string
+}
+
+func (ac *AuthCode) CreateAuthCode() res.ServerError {
+	serr := *new(res.ServerError)
+	result := *new(sql.Result)
+	err := *new(error)
+
+	serr.Query = "INSERT INTO authcodes(code, appid, userid, redirect_uri, scope, challenge, challenge_method, expires, nonce) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	serr.Args = append(serr.Args, util.HashToken(ac.Code), ac.AppID, ac.UserID, ac.RedirectURI, ac.Scope, ac.Challenge, ac.ChallengeMethod, ac.Expires, ac.Nonce)
+	result, serr.Err = db.Exec(serr.Query, serr.Args...)
+	if serr.Err != nil {
+		return serr
+	}
+
+	ac.ID, err = result.LastInsertId()
+	if err != nil {
+		log.Wtf(err)
+	}
+
+	return serr
+}
+
+// ConsumeAuthCode looks up an unexpired code and deletes it so it can never be exchanged twice
+func (ac *AuthCode) ConsumeAuthCode() res.ServerError {
+	serr := *new(res.ServerError)
+	var hash string
+
+	serr.Query = "SELECT * FROM authcodes WHERE code=? AND expires > ?"
+	serr.Args = append(serr.Args, util.HashToken(ac.Code), time.Now())
+	serr.Err = db.QueryRow(serr.Query, serr.Args...).Scan(
+		&ac.ID,
+		&hash,
+		&ac.AppID,
+		&ac.UserID,
+		&ac.RedirectURI,
+		&ac.Scope,
+		&ac.Challenge,
+		&ac.ChallengeMethod,
+		&ac.Expires,
+		&ac.Nonce)
+	if serr.Err != nil {
+		return serr
+	}
+
+	serr.Query = "DELETE FROM authcodes WHERE id=?"
+	serr.Args = []interface{}{ac.ID}
+	result := *new(sql.Result)
+	result, serr.Err = db.Exec(serr.Query, serr.Args...)
+	if serr.Err != nil {
+		return serr
+	}
+
+	// somebody else exchanged it between our select and delete
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		serr.Err = sql.ErrNoRows
+	}
+
+	return serr
+}
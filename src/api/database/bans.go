@@ -0,0 +1,163 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/log"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+)
+
+// how often the daemon looks for temporary bans that are over
+const banSweepInterval = time.Minute
+
+// Ban is why and until when a user is banned. the banned flag on the user is what everything
+// checks, bans are the record of who set it and when it comes off
+type Ban struct {
+	ID       int64      `json:"-"`
+	UserID   int64      `json:"-"`
+	Reason   string     `json:"reason"`
+	BannedBy *int64     `json:"-"`
+	Created  time.Time  `json:"created"`
+	Expires  *time.Time `json:"expires,omitempty"` // never when empty
+	Lifted   *time.Time `json:"-"`
+	LiftedBy *int64     `json:"-"`
+}
+
+// SQL FUNCTIONS =================================================================================
+
+// CreateBan bans b.UserID, taking the place of any ban they already had
+func (b *Ban) CreateBan() res.ServerError {
+	var serr res.ServerError
+	var result sql.Result
+	err := *new(error)
+
+	b.Created = time.Now()
+	serr.Query = "UPDATE bans SET lifted=?, lifted_by=? WHERE userid=? AND lifted IS NULL"
+	serr.Args = append(serr.Args, b.Created, b.BannedBy, b.UserID)
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	serr = *new(res.ServerError)
+	serr.Query = "INSERT INTO bans(userid, reason, banned_by, created, expires) VALUES(?, ?, ?, ?, ?)"
+	serr.Args = append(serr.Args, b.UserID, b.Reason, b.BannedBy, b.Created, b.Expires)
+	if result, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+	b.ID, err = result.LastInsertId()
+	if err != nil {
+		log.Wtf(err)
+	}
+
+	serr = *new(res.ServerError)
+	serr.Query = "UPDATE users SET banned=TRUE WHERE id=?"
+	serr.Args = append(serr.Args, b.UserID)
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+// GetActiveBan reads the ban b.UserID is under, sql.ErrNoRows if there isn't one on record
+func (b *Ban) GetActiveBan() res.ServerError {
+	var serr res.ServerError
+
+	serr.Query = "SELECT * FROM bans WHERE userid=? AND lifted IS NULL ORDER BY id DESC LIMIT 1"
+	serr.Args = append(serr.Args, b.UserID)
+	serr.Err = b.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+	return serr
+}
+
+// LiftBan unbans the user, liftedBy is empty when the ban ran out on its own. sql.ErrNoRows means
+// they weren't banned
+func LiftBan(userID int64, liftedBy *int64) res.ServerError {
+	var serr res.ServerError
+	var result sql.Result
+
+	serr.Query = "UPDATE bans SET lifted=?, lifted_by=? WHERE userid=? AND lifted IS NULL"
+	serr.Args = append(serr.Args, time.Now(), liftedBy, userID)
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	serr = *new(res.ServerError)
+	serr.Query = "UPDATE users SET banned=FALSE WHERE id=? AND banned=TRUE"
+	serr.Args = append(serr.Args, userID)
+	if result, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		serr.Err = sql.ErrNoRows
+	}
+	return serr
+}
+
+// LiftExpiredBans unbans everybody whose ban ran out by now, returning who they were
+func LiftExpiredBans(now time.Time) ([]int64, res.ServerError) {
+	var serr res.ServerError
+	var rows *sql.Rows
+
+	serr.Query = "SELECT userid FROM bans WHERE lifted IS NULL AND expires<=?"
+	serr.Args = append(serr.Args, now)
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if serr.Err = rows.Scan(&userID); serr.Err != nil {
+			rows.Close()
+			return nil, serr
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+
+	var lifted []int64
+	for _, userID := range userIDs {
+		if serr := LiftBan(userID, nil); serr.Err == sql.ErrNoRows {
+			continue // somebody lifted it by hand in the meantime
+		} else if serr.Err != nil {
+			return lifted, serr
+		}
+		lifted = append(lifted, userID)
+	}
+	return lifted, serr
+}
+
+// HELPER FUNCTIONS ==============================================================================
+
+// Active is whether the ban still holds at now, it may not have been lifted yet after running out
+func (b *Ban) Active(now time.Time) bool {
+	return b.Lifted == nil && (b.Expires == nil || b.Expires.After(now))
+}
+
+// BanDaemon lifts temporary bans once they run out
+func BanDaemon() {
+	for range time.Tick(banSweepInterval) {
+		lifted, serr := LiftExpiredBans(time.Now())
+		if serr.Err != nil {
+			log.Error("Could not lift expired bans, %v", serr.Err)
+		}
+		for i := range lifted {
+			e := AuditEvent{Type: AuditUnban, Target: &lifted[i], Detail: "ban expired"}
+			if serr := e.CreateAuditEvent(); serr.Err != nil {
+				log.Error("Could not record a %s audit event, %v", e.Type, serr.Err)
+			}
+		}
+	}
+}
+
+// scans all ban data from a row into the ban struct
+func (b *Ban) ScanAll(row *sql.Row) error {
+	return row.Scan(
+		&b.ID,
+		&b.UserID,
+		&b.Reason,
+		&b.BannedBy,
+		&b.Created,
+		&b.Expires,
+		&b.Lifted,
+		&b.LiftedBy)
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
+)
+
+// how many wrong codes a challenge takes before it's thrown away
+const mfaChallengeAttempts = 5
+
+// MFAChallenge is handed out by /login when the password was right but the user has two factor
+// on, it's traded in on /login/mfa along with a code
+type MFAChallenge struct {
+	ID int64
+	// Challenge is the plaintext token, only the hash of it is ever stored
+	Challenge string
+	UserID    int64
+	Attempts  int
+	Expires   time.Time
+}
+
+// SQL FUNCTIONS =================================================================================
+
+// CreateMFAChallenge stores the challenge, clearing out expired ones while it's at it
+func (c *MFAChallenge) CreateMFAChallenge() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "DELETE FROM mfachallenges WHERE expires < ?"
+	serr.Args = append(serr.Args, time.Now())
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	var result sql.Result
+	serr.Query = "INSERT INTO mfachallenges(challenge, userid, attempts, expires) VALUES(?, ?, 0, ?)"
+	serr.Args = []interface{}{util.HashToken(c.Challenge), c.UserID, c.Expires}
+	if result, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+	c.ID, serr.Err = result.LastInsertId()
+	return serr
+}
+
+// GetMFAChallenge looks up an unexpired challenge that hasn't run out of attempts
+func (c *MFAChallenge) GetMFAChallenge() res.ServerError {
+	var serr res.ServerError
+	var hash string
+	serr.Query = "SELECT * FROM mfachallenges WHERE challenge=? AND expires > ? AND attempts < ?"
+	serr.Args = append(serr.Args, util.HashToken(c.Challenge), time.Now(), mfaChallengeAttempts)
+	serr.Err = db.QueryRow(serr.Query, serr.Args...).Scan(
+		&c.ID,
+		&hash,
+		&c.UserID,
+		&c.Attempts,
+		&c.Expires)
+	return serr
+}
+
+// FailMFAChallenge counts a wrong code against the challenge
+func (c *MFAChallenge) FailMFAChallenge() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "UPDATE mfachallenges SET attempts=attempts+1 WHERE id=?"
+	serr.Args = append(serr.Args, c.ID)
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err == nil {
+		c.Attempts++
+	}
+	return serr
+}
+
+// DeleteMFAChallenge uses up the challenge once the login went through, if somebody else used it
+// first this fails with sql.ErrNoRows
+func (c *MFAChallenge) DeleteMFAChallenge() res.ServerError {
+	var serr res.ServerError
+	var result sql.Result
+	serr.Query = "DELETE FROM mfachallenges WHERE id=?"
+	serr.Args = append(serr.Args, c.ID)
+	if result, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		serr.Err = sql.ErrNoRows
+	}
+	return serr
+}
+
+// MFAMethods lists the second factors the user has set up, logging in with a password needs one
+func MFAMethods(userID int64) ([]string, res.ServerError) {
+	methods := []string{}
+	enabled, serr := TOTPEnabled(userID)
+	if serr.Err != nil {
+		return nil, serr
+	}
+	if enabled {
+		methods = append(methods, "totp")
+	}
+
+	var count int
+	serr.Query = "SELECT COUNT(*) FROM webauthncredentials WHERE userid=?"
+	serr.Args = []interface{}{userID}
+	if serr.Err = db.QueryRow(serr.Query, serr.Args...).Scan(&count); serr.Err != nil {
+		return nil, serr
+	}
+	if count > 0 {
+		methods = append(methods, "webauthn")
+	}
+	return methods, serr
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+)
+
+// Grant is the consent a user gave an application to act on the scopes in it
+type Grant struct {
+	ID      int64     `json:"id"`
+	UserID  int64     `json:"-"`
+	AppID   int64     `json:"application"`
+	Scope   string    `json:"scope"` // space separated
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	// not stored, filled in by GetGrants so the user knows who they're looking at
+	ClientID *string `json:"client_id,omitempty"`
+	Name     *string `json:"name,omitempty"`
+}
+
+// SQL FUNCTIONS =================================================================================
+
+// GetGrant looks up the grant g.UserID gave g.AppID
+func (g *Grant) GetGrant() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "SELECT * FROM grants WHERE userid=? AND appid=?"
+	serr.Args = append(serr.Args, g.UserID, g.AppID)
+	serr.Err = g.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+	return serr
+}
+
+// SaveGrant records the grant, replacing the scopes of any earlier grant to the same application
+func (g *Grant) SaveGrant() res.ServerError {
+	var serr res.ServerError
+	now := time.Now()
+	serr.Query = "INSERT INTO grants(userid, appid, scope, created, updated) VALUES(?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE scope=VALUES(scope), updated=VALUES(updated)"
+	serr.Args = append(serr.Args, g.UserID, g.AppID, g.Scope, now, now)
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+	return g.GetGrant()
+}
+
+// RevokeGrant deletes the grant and signs the user out of the application
+func (g *Grant) RevokeGrant() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "DELETE FROM grants WHERE userid=? AND appid=?"
+	serr.Args = append(serr.Args, g.UserID, g.AppID)
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	// tokens issued under these logins go with them
+	serr.Query = "UPDATE logins SET revoked=TRUE WHERE userid=? AND appid=?"
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+// GetGrants lists every application the user has given consent to
+func GetGrants(userID int64) ([]Grant, res.ServerError) {
+	var serr res.ServerError
+	var rows *sql.Rows
+	serr.Query = "SELECT grants.*, applications.str_id, applications.name FROM grants JOIN applications ON applications.id = grants.appid WHERE grants.userid=? ORDER BY grants.updated DESC"
+	serr.Args = append(serr.Args, userID)
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	defer rows.Close()
+
+	grants := []Grant{}
+
+	for rows.Next() {
+		var g Grant
+		if serr.Err = rows.Scan(&g.ID, &g.UserID, &g.AppID, &g.Scope, &g.Created, &g.Updated, &g.ClientID, &g.Name); serr.Err != nil {
+			return nil, serr
+		}
+		grants = append(grants, g)
+	}
+
+	return grants, serr
+}
+
+// HELPER FUNCTIONS ==============================================================================
+
+// scans all grant data into the grant struct
+func (g *Grant) ScanAll(row *sql.Row) error {
+	return row.Scan(
+		&g.ID,
+		&g.UserID,
+		&g.AppID,
+		&g.Scope,
+		&g.Created,
+		&g.Updated)
+}
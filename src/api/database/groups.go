@@ -0,0 +1,235 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+)
+
+type Group struct {
+	ID int64 `json:"id"`
+	// Read: ADMIN
+	// Write: Nobody
+	Name *string `json:"name,omitempty"`
+	// Read: ADMIN
+	// Write: ADMIN
+	Description *string `json:"description,omitempty"`
+	// Read: ADMIN
+	// Write: ADMIN
+	Scopes []string `json:"scopes,omitempty"`
+	// Read: ADMIN (only filled in by GetScopes)
+	// Write: ADMIN (through the permissions table)
+}
+
+type GroupList struct {
+	StartIndex int     `json:"startIndex"`       // starting index
+	TotalItems int     `json:"totalItems"`       // how many items are returned
+	Groups     []Group `json:"groups,omitempty"` // group array
+}
+
+// SQL FUNCTIONS =================================================================================
+
+func (g *Group) GetGroup() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "SELECT * FROM `groups` WHERE id=?"
+	serr.Args = append(serr.Args, g.ID)
+	serr.Err = g.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+	return serr
+}
+
+func (g *Group) GetGroupByName() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "SELECT * FROM `groups` WHERE name=?"
+	serr.Args = append(serr.Args, g.Name)
+	serr.Err = g.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+	return serr
+}
+
+func (g *Group) CreateGroup() res.ServerError {
+	var serr res.ServerError
+	var result sql.Result
+	serr.Query = "INSERT INTO `groups`(name, description) VALUES(?, ?)"
+	serr.Args = append(serr.Args, g.Name, g.Description)
+	result, serr.Err = db.Exec(serr.Query, serr.Args...)
+	if serr.Err != nil {
+		return serr
+	}
+	g.ID, _ = result.LastInsertId() // we confirmed that there will be no error
+	return serr
+}
+
+func (g *Group) UpdateGroup() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "UPDATE `groups` SET"
+
+	if g.Name != nil {
+		serr.Query += " name=?,"
+		serr.Args = append(serr.Args, g.Name)
+	}
+	if g.Description != nil {
+		serr.Query += " description=?,"
+		serr.Args = append(serr.Args, g.Description)
+	}
+
+	if len(serr.Args) == 0 {
+		return serr // there were no sections to update
+	}
+
+	serr.Query = serr.Query[:len(serr.Query)-1] + " WHERE id=?" // remove last comma of query and add WHERE condition
+	serr.Args = append(serr.Args, g.ID)
+
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+func (g *Group) DeleteGroup() res.ServerError {
+	var serr res.ServerError
+
+	// the group takes its scopes and members with it
+	serr.Query = "DELETE FROM permissions WHERE groupid=?"
+	serr.Args = append(serr.Args, g.ID)
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	serr.Query = "DELETE FROM memberships WHERE groupid=?"
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	serr.Query = "DELETE FROM `groups` WHERE id=?"
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+func GetGroups(start, count int) (*GroupList, res.ServerError) {
+	var serr res.ServerError
+	var rows *sql.Rows
+	serr.Query = "SELECT * FROM `groups` LIMIT ? OFFSET ?"
+	serr.Args = append(serr.Args, count, start)
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	defer rows.Close()
+
+	groups := []Group{}
+
+	for rows.Next() {
+		var g Group
+		if serr.Err = g.ScanAlls(rows); serr.Err != nil {
+			return nil, serr
+		}
+		groups = append(groups, g)
+	}
+
+	return &GroupList{Groups: groups, StartIndex: start, TotalItems: len(groups)}, serr
+}
+
+// GetScopes fills in the names of the scopes the group grants
+func (g *Group) GetScopes() res.ServerError {
+	var serr res.ServerError
+	var rows *sql.Rows
+	serr.Query = "SELECT scopes.name FROM permissions JOIN scopes ON scopes.id = permissions.scopeid WHERE permissions.groupid=? ORDER BY scopes.name"
+	serr.Args = append(serr.Args, g.ID)
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+
+	if serr.Err != nil {
+		return serr
+	}
+
+	defer rows.Close()
+
+	g.Scopes = []string{}
+
+	for rows.Next() {
+		var scope string
+		if serr.Err = rows.Scan(&scope); serr.Err != nil {
+			return serr
+		}
+		g.Scopes = append(g.Scopes, scope)
+	}
+
+	return serr
+}
+
+// GetMembers lists the ids of the users in the group
+func (g *Group) GetMembers() ([]int64, res.ServerError) {
+	var serr res.ServerError
+	var rows *sql.Rows
+	serr.Query = "SELECT userid FROM memberships WHERE groupid=?"
+	serr.Args = append(serr.Args, g.ID)
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	defer rows.Close()
+
+	members := []int64{}
+
+	for rows.Next() {
+		var id int64
+		if serr.Err = rows.Scan(&id); serr.Err != nil {
+			return nil, serr
+		}
+		members = append(members, id)
+	}
+
+	return members, serr
+}
+
+// AddScope grants the scope to every member of the group, doing nothing if it already does
+func (g *Group) AddScope(scopeID int64) res.ServerError {
+	var serr res.ServerError
+	serr.Query = "INSERT INTO permissions (groupid, scopeid) SELECT ?, ? FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE groupid=? AND scopeid=?)"
+	serr.Args = append(serr.Args, g.ID, scopeID, g.ID, scopeID)
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+func (g *Group) RemoveScope(scopeID int64) res.ServerError {
+	var serr res.ServerError
+	serr.Query = "DELETE FROM permissions WHERE groupid=? AND scopeid=?"
+	serr.Args = append(serr.Args, g.ID, scopeID)
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+// AddMember puts the user in the group, doing nothing if they already are
+func (g *Group) AddMember(userID int64) res.ServerError {
+	var serr res.ServerError
+	serr.Query = "INSERT INTO memberships (userid, groupid) SELECT ?, ? FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM memberships WHERE userid=? AND groupid=?)"
+	serr.Args = append(serr.Args, userID, g.ID, userID, g.ID)
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+func (g *Group) RemoveMember(userID int64) res.ServerError {
+	var serr res.ServerError
+	serr.Query = "DELETE FROM memberships WHERE userid=? AND groupid=?"
+	serr.Args = append(serr.Args, userID, g.ID)
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+// HELPER FUNCTIONS ==============================================================================
+
+// scans all group data into the group struct
+func (g *Group) ScanAll(row *sql.Row) error {
+	return row.Scan(
+		&g.ID,
+		&g.Name,
+		&g.Description)
+}
+
+// scans all group data into the group struct (for rows)
+func (g *Group) ScanAlls(rows *sql.Rows) error {
+	return rows.Scan(
+		&g.ID,
+		&g.Name,
+		&g.Description)
+}
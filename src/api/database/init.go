@@ -11,7 +11,7 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-const version uint8 = 18
+const version uint8 = 46
 
 var db *sql.DB
 
@@ -226,6 +226,258 @@ func Init() error {
 			}
 			fallthrough
 
+		case 18:
+			log.Info("Migrate current Database Schema to 19")
+			err := setupSchema("00019_authcodes.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 19:
+			log.Info("Migrate current Database Schema to 20")
+			err := setupSchema("00020_authcodenonce.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 20:
+			log.Info("Migrate current Database Schema to 21")
+			err := setupSchema("00021_signingkeys.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 21:
+			log.Info("Migrate current Database Schema to 22")
+			err := setupSchema("00022_refreshtokens.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 22:
+			log.Info("Migrate current Database Schema to 23")
+			err := setupSchema("00023_loginuseragent.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 23:
+			log.Info("Migrate current Database Schema to 24")
+			err := setupSchema("00024_tokens.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 24:
+			log.Info("Migrate current Database Schema to 25")
+			err := setupSchema("00025_adminmemberships.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 25:
+			log.Info("Migrate current Database Schema to 26")
+			err := setupSchema("00026_uniquescopes.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 26:
+			log.Info("Migrate current Database Schema to 27")
+			err := setupSchema("00027_identityscopes.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 27:
+			log.Info("Migrate current Database Schema to 28")
+			err := setupSchema("00028_grants.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 28:
+			log.Info("Migrate current Database Schema to 29")
+			err := setupSchema("00029_applicationscopes.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 29:
+			log.Info("Migrate current Database Schema to 30")
+			err := setupSchema("00030_clienttokens.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 30:
+			log.Info("Migrate current Database Schema to 31")
+			err := setupSchema("00031_totp.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 31:
+			log.Info("Migrate current Database Schema to 32")
+			err := setupSchema("00032_recoverycodes.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 32:
+			log.Info("Migrate current Database Schema to 33")
+			err := setupSchema("00033_mfachallenges.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 33:
+			log.Info("Migrate current Database Schema to 34")
+			err := setupSchema("00034_webauthncredentials.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 34:
+			log.Info("Migrate current Database Schema to 35")
+			err := setupSchema("00035_webauthnchallenges.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 35:
+			log.Info("Migrate current Database Schema to 36")
+			err := setupSchema("00036_magicpurpose.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 36:
+			log.Info("Migrate current Database Schema to 37")
+			err := setupSchema("00037_magichash.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 37:
+			log.Info("Migrate current Database Schema to 38")
+			err := setupSchema("00038_magicused.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 38:
+			log.Info("Migrate current Database Schema to 39")
+			err := setupSchema("00039_magicsent.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 39:
+			log.Info("Migrate current Database Schema to 40")
+			err := setupSchema("00040_auditevents.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 40:
+			log.Info("Migrate current Database Schema to 41")
+			err := setupSchema("00041_bans.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 41:
+			log.Info("Migrate current Database Schema to 42")
+			err := setupSchema("00042_userpurge.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 42:
+			log.Info("Migrate current Database Schema to 43")
+			err := setupSchema("00043_usersscope.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 43:
+			log.Info("Migrate current Database Schema to 44")
+			err := setupSchema("00044_spenttokens.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 44:
+			log.Info("Migrate current Database Schema to 45")
+			err := setupSchema("00045_spentprevious.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
+		case 45:
+			log.Info("Migrate current Database Schema to 46")
+			err := setupSchema("00046_dropprevious.sql")
+			if err != nil {
+				log.Error("Schema failed to execute successfully")
+				return err
+			}
+			fallthrough
+
 		default:
 			db.Exec(`UPDATE meta SET db_version=? WHERE db_version=?`, version, current)
 
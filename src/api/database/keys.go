@@ -0,0 +1,75 @@
+package database
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/log"
+)
+
+// KeyStore keeps the token signing keys in the signing_keys table
+type KeyStore struct{}
+
+func (KeyStore) LoadKeys() ([]authentication.SigningKey, error) {
+	rows, err := db.Query("SELECT * FROM signing_keys")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []authentication.SigningKey{}
+	for rows.Next() {
+		var key authentication.SigningKey
+		var private string
+		if err := rows.Scan(&key.ID, &key.Algorithm, &private, &key.Created, &key.Retires, &key.Expires); err != nil {
+			return nil, err
+		}
+
+		if key.Private, err = decodePrivateKey(private); err != nil {
+			// one bad key shouldn't stop us from verifying with the rest
+			log.Error("Could not decode signing key "+key.ID+", %v", err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (KeyStore) SaveKey(key authentication.SigningKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return err
+	}
+	private := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	_, err = db.Exec("INSERT INTO signing_keys(kid, algorithm, private_key, created, retires, expires) VALUES(?, ?, ?, ?, ?, ?)",
+		key.ID, key.Algorithm, string(private), key.Created, key.Retires, key.Expires)
+	return err
+}
+
+func (KeyStore) DeleteKey(id string) error {
+	_, err := db.Exec("DELETE FROM signing_keys WHERE kid=?", id)
+	return err
+}
+
+func decodePrivateKey(private string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(private))
+	if block == nil {
+		return nil, errors.New("no pem block found")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("key can't sign")
+	}
+	return signer, nil
+}
@@ -0,0 +1,273 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/log"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
+)
+
+// RefreshTokenLifetime is how long a refresh token can sit unused before it stops working
+const RefreshTokenLifetime = time.Hour * 24 * 30
+
+// ErrRefreshTokenReused is returned when a refresh token that was already rotated is presented
+// again, which means it was stolen by somebody, so the whole login gets revoked
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// Login is a signed in session in the logins table, carrying its current refresh token
+type Login struct {
+	ID       int64  `json:"id"`
+	UserID   int64  `json:"-"`
+	UserUUID string `json:"-"`
+	// Token is the plaintext refresh token, only set right after it was created or rotated
+	Token     string    `json:"-"`
+	IP        net.IP    `json:"ip"`
+	Created   time.Time `json:"created"`
+	Expires   time.Time `json:"expires"`
+	Revoked   bool      `json:"-"`
+	AppID     *int64    `json:"application,omitempty"` // application the login was made through, nil for first party logins
+	Scope     *string   `json:"scope,omitempty"`       // scopes the application was granted
+	UserAgent *string   `json:"user_agent,omitempty"`
+	Current   bool      `json:"current"` // not stored, set when listing for the session making the request
+}
+
+func (l *Login) CreateLogin() res.ServerError {
+	serr := *new(res.ServerError)
+	result := *new(sql.Result)
+	err := *new(error)
+
+	if l.Token, err = util.CreateSecureString(64); err != nil {
+		serr.Err = err
+		return serr
+	}
+	l.Created = time.Now()
+	l.Expires = l.Created.Add(RefreshTokenLifetime)
+	ipv4, ipv6 := splitIP(l.IP)
+
+	serr.Query = "INSERT INTO logins(userid, useruuid, token, ipaddrv4, ipaddrv6, created, expires, appid, scope, user_agent) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	serr.Args = append(serr.Args, l.UserID, l.UserUUID, util.HashToken(l.Token), ipv4, ipv6, l.Created, l.Expires, l.AppID, l.Scope, l.UserAgent)
+	result, serr.Err = db.Exec(serr.Query, serr.Args...)
+	if serr.Err != nil {
+		return serr
+	}
+
+	l.ID, err = result.LastInsertId()
+	if err != nil {
+		log.Wtf(err)
+	}
+
+	return serr
+}
+
+// RotateLogin trades the refresh token in l.Token for a new one. l.AppID has to match the
+// application the login was made through. sql.ErrNoRows means the token is unknown, expired,
+// revoked or for another application, ErrRefreshTokenReused means the login was just revoked
+func (l *Login) RotateLogin() res.ServerError {
+	serr := *new(res.ServerError)
+	presented := util.HashToken(l.Token)
+	app := l.AppID
+
+	serr.Query = "SELECT * FROM logins WHERE token=?"
+	serr.Args = append(serr.Args, presented)
+	serr.Err = l.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+	if serr.Err == sql.ErrNoRows {
+		return l.detectReuse(presented)
+	} else if serr.Err != nil {
+		return serr
+	}
+
+	sameApp := (app == nil && l.AppID == nil) || (app != nil && l.AppID != nil && *app == *l.AppID)
+	if l.Revoked || time.Now().After(l.Expires) || !sameApp {
+		serr.Err = sql.ErrNoRows
+		return serr
+	}
+
+	token, err := util.CreateSecureString(64)
+	if err != nil {
+		serr.Err = err
+		return serr
+	}
+	l.Expires = time.Now().Add(RefreshTokenLifetime)
+
+	// the presented token is kept as spent along with the rotation, so it can never come back
+	// as a plain miss however many rotations later it's replayed
+	var tx *sql.Tx
+	if tx, serr.Err = db.Begin(); serr.Err != nil {
+		return serr
+	}
+	defer tx.Rollback() // nothing to undo once it's committed
+
+	// only rotate if nobody beat us to it, otherwise two clients are holding the same token
+	serr.Query = "UPDATE logins SET token=?, expires=? WHERE id=? AND token=?"
+	serr.Args = []interface{}{util.HashToken(token), l.Expires, l.ID, presented}
+	result := *new(sql.Result)
+	if result, serr.Err = tx.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		tx.Rollback()
+		return l.detectReuse(presented)
+	}
+
+	serr.Query = "INSERT INTO spenttokens(token, loginid) VALUES(?, ?)"
+	serr.Args = []interface{}{presented, l.ID}
+	if _, serr.Err = tx.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	serr = *new(res.ServerError)
+	if serr.Err = tx.Commit(); serr.Err != nil {
+		return serr
+	}
+
+	l.Token = token
+	return serr
+}
+
+// revokes the login a rotated token belonged to, if it belonged to any
+func (l *Login) detectReuse(hash string) res.ServerError {
+	serr := *new(res.ServerError)
+
+	serr.Query = "SELECT * FROM logins WHERE id=(SELECT loginid FROM spenttokens WHERE token=?)"
+	serr.Args = append(serr.Args, hash)
+	serr.Err = l.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+	if serr.Err != nil {
+		return serr
+	}
+
+	log.Warning("Refresh token reuse detected, revoking login ", l.ID)
+	if serr = l.RevokeLogin(); serr.Err != nil {
+		return serr
+	}
+
+	serr.Err = ErrRefreshTokenReused
+	return serr
+}
+
+func (l *Login) GetLogin() res.ServerError {
+	serr := *new(res.ServerError)
+
+	serr.Query = "SELECT * FROM logins WHERE id=?"
+	serr.Args = append(serr.Args, l.ID)
+	serr.Err = l.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+
+	return serr
+}
+
+func (l *Login) RevokeLogin() res.ServerError {
+	serr := *new(res.ServerError)
+
+	serr.Query = "UPDATE logins SET revoked=TRUE WHERE id=?"
+	serr.Args = append(serr.Args, l.ID)
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	l.Revoked = serr.Err == nil
+
+	return serr
+}
+
+// GetLogins lists every login of the user that can still be refreshed
+func GetLogins(userID int64) ([]Login, res.ServerError) {
+	var serr res.ServerError
+	var rows *sql.Rows
+	serr.Query = "SELECT * FROM logins WHERE userid=? AND revoked=FALSE AND expires > ? ORDER BY created DESC"
+	serr.Args = append(serr.Args, userID, time.Now())
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	defer rows.Close()
+
+	logins := []Login{}
+
+	for rows.Next() {
+		var l Login
+		if serr.Err = l.ScanAlls(rows); serr.Err != nil {
+			return nil, serr
+		}
+		logins = append(logins, l)
+	}
+
+	return logins, serr
+}
+
+// RevokeLogins signs the user out everywhere
+func RevokeLogins(userID int64) res.ServerError {
+	var serr res.ServerError
+	serr.Query = "UPDATE logins SET revoked=TRUE WHERE userid=?"
+	serr.Args = append(serr.Args, userID)
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+// LoginStore lets the authentication package check tokens against the logins table
+type LoginStore struct{}
+
+// SessionActive reports if the login a token was issued under hasn't been revoked
+func (LoginStore) SessionActive(id int64) (bool, error) {
+	var revoked bool
+	err := db.QueryRow("SELECT revoked FROM logins WHERE id=?", id).Scan(&revoked)
+	if err == sql.ErrNoRows { // the login is gone, so is anything issued under it
+		return false, nil
+	}
+	return err == nil && !revoked, err
+}
+
+// HELPER FUNCTIONS ==============================================================================
+
+// scans all login data into the login struct
+func (l *Login) ScanAll(row *sql.Row) error {
+	return l.scan(row.Scan)
+}
+
+// scans all login data into the login struct (for rows)
+func (l *Login) ScanAlls(rows *sql.Rows) error {
+	return l.scan(rows.Scan)
+}
+
+func (l *Login) scan(scan func(dest ...interface{}) error) error {
+	var ipv4, ipv6 []byte
+	var token string
+
+	err := scan(
+		&l.ID,
+		&l.UserID,
+		&l.UserUUID,
+		&token,
+		&ipv4,
+		&ipv6,
+		&l.Created,
+		&l.Expires,
+		&l.Revoked,
+		&l.AppID,
+		&l.Scope,
+		&l.UserAgent)
+	l.IP = joinIP(ipv4, ipv6)
+	return err
+}
+
+// the logins table keeps v4 and v6 addresses in their own binary columns
+func splitIP(ip net.IP) ([]byte, []byte) {
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return []byte(ipv4), nil
+	}
+	if ipv6 := ip.To16(); ipv6 != nil {
+		return nil, []byte(ipv6)
+	}
+	return nil, nil
+}
+
+func joinIP(ipv4, ipv6 []byte) net.IP {
+	if len(ipv4) == net.IPv4len {
+		return net.IPv4(ipv4[0], ipv4[1], ipv4[2], ipv4[3])
+	}
+	if len(ipv6) == net.IPv6len {
+		return net.IP(ipv6)
+	}
+	return nil
+}
@@ -2,9 +2,26 @@ package database
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/IWannaCommunity/gate-jump/src/api/log"
 	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
+)
+
+// what a magic link was sent for, a link only works for what it was sent for
+const (
+	MagicVerify = "verify" // confirms the user's email address
+	MagicReset  = "reset"  // lets the user choose a new password
+	MagicEmail  = "email"  // moves the user to the address it was sent to
+	MagicUndo   = "undo"   // moves the user back to the address it was sent to
+)
+
+const (
+	// how often the daemon clears out links nobody can use anymore
+	magicSweepInterval = time.Hour
+	// how long a dead link is kept around so it can be told apart from one that never existed
+	magicRetention = time.Hour * 24 * 7
 )
 
 type MagicLink struct {
@@ -14,18 +31,36 @@ type MagicLink struct {
 	UserID int64 `json:"userid"`
 	// Read: SERVER
 	// Write: SERVER
-	Magic string `json:"magic"`
+	Magic string `json:"magic"` // only the hash of it is ever stored
 	// Read: USER
 	// Write: SERVER
+	Purpose string `json:"purpose"`
+	// Read: SERVER
+	// Write: SERVER
+	ExpiresAt time.Time `json:"expires_at"`
+	// Read: SERVER
+	// Write: SERVER
+	UsedAt *time.Time `json:"used_at,omitempty"`
+	// Read: SERVER
+	// Write: SERVER
+	Email string `json:"email"` // where the link was sent
+	// Read: SERVER
+	// Write: SERVER
+	Created time.Time `json:"created"`
+	// Read: SERVER
+	// Write: Nobody
 }
 
+// SQL FUNCTIONS =================================================================================
+
 func (ml *MagicLink) CreateMagicLink() res.ServerError {
 	serr := *new(res.ServerError)
 	result := *new(sql.Result)
 	err := *new(error)
 
-	serr.Query = "INSERT INTO magic(userid, magic) VALUES(?, ?)"
-	serr.Args = append(serr.Args, ml.UserID, ml.Magic)
+	ml.Created = time.Now()
+	serr.Query = "INSERT INTO magic(userid, magic, purpose, expires_at, email, created) VALUES(?, ?, ?, ?, ?, ?)"
+	serr.Args = append(serr.Args, ml.UserID, util.HashToken(ml.Magic), ml.Purpose, ml.ExpiresAt, ml.Email, ml.Created)
 	result, serr.Err = db.Exec(serr.Query, serr.Args...)
 	if serr.Err != nil {
 		return serr
@@ -39,11 +74,13 @@ func (ml *MagicLink) CreateMagicLink() res.ServerError {
 	return serr
 }
 
+// GetMagicLinkFromMagicString looks up the link sent for ml.Purpose, used and expired links are
+// found too so check Usable before acting on it
 func (ml *MagicLink) GetMagicLinkFromMagicString() res.ServerError {
 	serr := *new(res.ServerError)
 
-	serr.Query = "SELECT * FROM magic WHERE magic = ?"
-	serr.Args = append(serr.Args, ml.Magic)
+	serr.Query = "SELECT * FROM magic WHERE magic = ? AND purpose = ?"
+	serr.Args = append(serr.Args, util.HashToken(ml.Magic), ml.Purpose)
 	serr.Err = ml.ScanAll(db.QueryRow(serr.Query, serr.Args...))
 	if serr.Err != nil {
 		return serr
@@ -52,24 +89,104 @@ func (ml *MagicLink) GetMagicLinkFromMagicString() res.ServerError {
 	return serr
 }
 
-func (ml *MagicLink) DeleteMagicLinkFromMagicString() res.ServerError {
+// UseMagicLink marks the link used, returning sql.ErrNoRows if it was used or expired already
+func (ml *MagicLink) UseMagicLink() res.ServerError {
 	serr := *new(res.ServerError)
+	result := *new(sql.Result)
+	now := time.Now()
 
-	serr.Query = "DELETE FROM magic WHERE magic = ? LIMIT 1"
-	serr.Args = append(serr.Args, ml.Magic)
-	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	serr.Query = "UPDATE magic SET used_at = ? WHERE id = ? AND used_at IS NULL AND expires_at > ?"
+	serr.Args = append(serr.Args, now, ml.ID, now)
+	result, serr.Err = db.Exec(serr.Query, serr.Args...)
 	if serr.Err != nil {
 		return serr
 	}
 
+	// somebody else used it between our select and update
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		serr.Err = sql.ErrNoRows
+		return serr
+	}
+	ml.UsedAt = &now
 	return serr
 }
 
-// scans all user data into the user struct
+// ExpireMagicLinks ends every link the user was sent for purpose, so only the newest works
+func ExpireMagicLinks(userID int64, purpose string) res.ServerError {
+	serr := *new(res.ServerError)
+	now := time.Now()
+
+	serr.Query = "UPDATE magic SET expires_at = ? WHERE userid = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?"
+	serr.Args = append(serr.Args, now, userID, purpose, now)
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+// CountMagicLinks counts the links for purpose sent to the user or to the email since the given
+// time, whichever has been sent more
+func CountMagicLinks(userID int64, email string, purpose string, since time.Time) (int, res.ServerError) {
+	serr := *new(res.ServerError)
+	var byUser, byEmail int
+
+	serr.Query = "SELECT COUNT(*) FROM magic WHERE userid = ? AND purpose = ? AND created > ?"
+	serr.Args = append(serr.Args, userID, purpose, since)
+	if serr.Err = db.QueryRow(serr.Query, serr.Args...).Scan(&byUser); serr.Err != nil {
+		return 0, serr
+	}
+
+	serr.Query = "SELECT COUNT(*) FROM magic WHERE email = ? AND purpose = ? AND created > ?"
+	serr.Args = []interface{}{email, purpose, since}
+	if serr.Err = db.QueryRow(serr.Query, serr.Args...).Scan(&byEmail); serr.Err != nil {
+		return 0, serr
+	}
+
+	if byEmail > byUser {
+		return byEmail, serr
+	}
+	return byUser, serr
+}
+
+// PurgeMagicLinks deletes links that were used or expired before the given time
+func PurgeMagicLinks(before time.Time) res.ServerError {
+	serr := *new(res.ServerError)
+
+	serr.Query = "DELETE FROM magic WHERE expires_at < ? OR used_at < ?"
+	serr.Args = append(serr.Args, before, before)
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+// HELPER FUNCTIONS ==============================================================================
+
+// Usable reports if the link can still be used, it can't once it's used or expired
+func (ml *MagicLink) Usable() bool {
+	return ml.UsedAt == nil && time.Now().Before(ml.ExpiresAt)
+}
+
+// MagicLinkDaemon keeps dead links from piling up
+func MagicLinkDaemon() {
+	for range time.Tick(magicSweepInterval) {
+		if serr := PurgeMagicLinks(time.Now().Add(-magicRetention)); serr.Err != nil {
+			log.Error("Could not purge stale magic links, %v", serr.Err)
+		}
+	}
+}
+
+// scans all magic link data into the magic link struct, the stored hash is left out since
+// ml.Magic is what was looked up by
 func (ml *MagicLink) ScanAll(row *sql.Row) error {
+	var hash string
+	var email sql.NullString
 
-	return row.Scan(
+	err := row.Scan(
 		&ml.ID,
 		&ml.UserID,
-		&ml.Magic)
+		&hash,
+		&ml.Purpose,
+		&ml.ExpiresAt,
+		&ml.UsedAt,
+		&email,
+		&ml.Created)
+	ml.Email = email.String
+	return err
 }
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+)
+
+// GetUserScopes resolves the scopes a user holds through the groups they're a member of
+func GetUserScopes(userID int64) ([]string, res.ServerError) {
+	var serr res.ServerError
+	var rows *sql.Rows
+	serr.Query = "SELECT DISTINCT scopes.name FROM memberships JOIN permissions ON permissions.groupid = memberships.groupid JOIN scopes ON scopes.id = permissions.scopeid WHERE memberships.userid=? ORDER BY scopes.name"
+	serr.Args = append(serr.Args, userID)
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	defer rows.Close()
+
+	scopes := []string{}
+
+	for rows.Next() {
+		var scope string
+		if serr.Err = rows.Scan(&scope); serr.Err != nil {
+			return nil, serr
+		}
+		scopes = append(scopes, scope)
+	}
+
+	return scopes, serr
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"strings"
 
 	"github.com/IWannaCommunity/gate-jump/src/api/res"
 )
@@ -12,6 +13,14 @@ type Scope struct {
 	Description *string `json:"description"`
 }
 
+type ScopeList struct {
+	StartIndex int     `json:"startIndex"`       // starting index
+	TotalItems int     `json:"totalItems"`       // how many items are returned
+	Scopes     []Scope `json:"scopes,omitempty"` // scope array
+}
+
+// SQL FUNCTIONS =================================================================================
+
 func CreateScope(name, description string) (res.ServerError, *Scope) {
 	s := &Scope{
 		Name:        &name,
@@ -30,3 +39,195 @@ func CreateScope(name, description string) (res.ServerError, *Scope) {
 	s.ID, _ = result.LastInsertId()
 	return serr, s
 }
+
+func (s *Scope) GetScope() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "SELECT * FROM scopes WHERE id=?"
+	serr.Args = append(serr.Args, s.ID)
+	serr.Err = s.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+	return serr
+}
+
+func (s *Scope) GetScopeByName() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "SELECT * FROM scopes WHERE name=?"
+	serr.Args = append(serr.Args, s.Name)
+	serr.Err = s.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+	return serr
+}
+
+func (s *Scope) UpdateScope() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "UPDATE scopes SET"
+
+	if s.Name != nil {
+		serr.Query += " name=?,"
+		serr.Args = append(serr.Args, s.Name)
+	}
+	if s.Description != nil {
+		serr.Query += " description=?,"
+		serr.Args = append(serr.Args, s.Description)
+	}
+
+	if len(serr.Args) == 0 {
+		return serr // there were no sections to update
+	}
+
+	serr.Query = serr.Query[:len(serr.Query)-1] + " WHERE id=?" // remove last comma of query and add WHERE condition
+	serr.Args = append(serr.Args, s.ID)
+
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+func (s *Scope) DeleteScope() res.ServerError {
+	var serr res.ServerError
+
+	// no group grants it anymore
+	serr.Query = "DELETE FROM permissions WHERE scopeid=?"
+	serr.Args = append(serr.Args, s.ID)
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	// and no application is assigned it
+	serr.Query = "DELETE FROM application_scopes WHERE scopeid=?"
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	serr.Query = "DELETE FROM scopes WHERE id=?"
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+func GetScopes(start, count int) (*ScopeList, res.ServerError) {
+	var serr res.ServerError
+	var rows *sql.Rows
+	serr.Query = "SELECT * FROM scopes LIMIT ? OFFSET ?"
+	serr.Args = append(serr.Args, count, start)
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	defer rows.Close()
+
+	scopes := []Scope{}
+
+	for rows.Next() {
+		var s Scope
+		if serr.Err = s.ScanAlls(rows); serr.Err != nil {
+			return nil, serr
+		}
+		scopes = append(scopes, s)
+	}
+
+	return &ScopeList{Scopes: scopes, StartIndex: start, TotalItems: len(scopes)}, serr
+}
+
+// GetScopesByName looks up every scope in names, names that aren't scopes are left out
+func GetScopesByName(names []string) ([]Scope, res.ServerError) {
+	var serr res.ServerError
+	var rows *sql.Rows
+
+	scopes := []Scope{}
+	if len(names) == 0 {
+		return scopes, serr
+	}
+
+	serr.Query = "SELECT * FROM scopes WHERE name IN (?" + strings.Repeat(", ?", len(names)-1) + ") ORDER BY name"
+	for _, name := range names {
+		serr.Args = append(serr.Args, name)
+	}
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var s Scope
+		if serr.Err = s.ScanAlls(rows); serr.Err != nil {
+			return nil, serr
+		}
+		scopes = append(scopes, s)
+	}
+
+	return scopes, serr
+}
+
+// GetHolders lists the ids of the users holding the scope through any of their groups
+func (s *Scope) GetHolders() ([]int64, res.ServerError) {
+	var serr res.ServerError
+	var rows *sql.Rows
+	serr.Query = "SELECT DISTINCT memberships.userid FROM permissions JOIN memberships ON memberships.groupid = permissions.groupid WHERE permissions.scopeid=?"
+	serr.Args = append(serr.Args, s.ID)
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	defer rows.Close()
+
+	holders := []int64{}
+
+	for rows.Next() {
+		var id int64
+		if serr.Err = rows.Scan(&id); serr.Err != nil {
+			return nil, serr
+		}
+		holders = append(holders, id)
+	}
+
+	return holders, serr
+}
+
+// GetClients lists the ids of the applications assigned the scope
+func (s *Scope) GetClients() ([]int64, res.ServerError) {
+	var serr res.ServerError
+	var rows *sql.Rows
+	serr.Query = "SELECT appid FROM application_scopes WHERE scopeid=?"
+	serr.Args = append(serr.Args, s.ID)
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	defer rows.Close()
+
+	clients := []int64{}
+
+	for rows.Next() {
+		var id int64
+		if serr.Err = rows.Scan(&id); serr.Err != nil {
+			return nil, serr
+		}
+		clients = append(clients, id)
+	}
+
+	return clients, serr
+}
+
+// HELPER FUNCTIONS ==============================================================================
+
+// scans all scope data into the scope struct
+func (s *Scope) ScanAll(row *sql.Row) error {
+	return row.Scan(
+		&s.ID,
+		&s.Name,
+		&s.Description)
+}
+
+// scans all scope data into the scope struct (for rows)
+func (s *Scope) ScanAlls(rows *sql.Rows) error {
+	return rows.Scan(
+		&s.ID,
+		&s.Name,
+		&s.Description)
+}
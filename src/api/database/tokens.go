@@ -0,0 +1,73 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+)
+
+// TokenStore keeps track of issued tokens in the tokens table so they can be revoked
+type TokenStore struct{}
+
+// records a token we issued by its jti, tokens belong to a user or act as an application
+func recordToken(jti string, userID, appID *int64, expires time.Time) error {
+	_, err := db.Exec("INSERT INTO tokens(jti, userid, appid, expires) VALUES(?, ?, ?, ?)", jti, userID, appID, expires)
+	return err
+}
+
+// TokenRevoked reports if the token was revoked, tokens we have no record of aren't
+func (TokenStore) TokenRevoked(jti string) (bool, error) {
+	var revoked bool
+	err := db.QueryRow("SELECT revoked FROM tokens WHERE jti=?", jti).Scan(&revoked)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return revoked, err
+}
+
+func (TokenStore) RevokeToken(jti string) error {
+	_, err := db.Exec("UPDATE tokens SET revoked=TRUE WHERE jti=?", jti)
+	return err
+}
+
+// RevokeUserTokens revokes every token of the user that hasn't expired yet
+func (TokenStore) RevokeUserTokens(userID int64) ([]authentication.RevokedToken, error) {
+	return revokeTokens("userid", userID)
+}
+
+// RevokeClientTokens revokes every token acting as the application that hasn't expired yet
+func (TokenStore) RevokeClientTokens(appID int64) ([]authentication.RevokedToken, error) {
+	return revokeTokens("appid", appID)
+}
+
+// revokes the unexpired tokens whose column matches id, the column is never user input
+func revokeTokens(column string, id int64) ([]authentication.RevokedToken, error) {
+	now := time.Now()
+	rows, err := db.Query("SELECT jti, expires FROM tokens WHERE "+column+"=? AND expires > ? AND revoked=FALSE", id, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []authentication.RevokedToken{}
+	for rows.Next() {
+		var token authentication.RevokedToken
+		if err := rows.Scan(&token.ID, &token.Expires); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec("UPDATE tokens SET revoked=TRUE WHERE "+column+"=? AND expires > ?", id, now)
+	return tokens, err
+}
+
+// PurgeExpiredTokens forgets tokens that are past their expiry, revoked or not they're useless now
+func (TokenStore) PurgeExpiredTokens() error {
+	_, err := db.Exec("DELETE FROM tokens WHERE expires < ?", time.Now())
+	return err
+}
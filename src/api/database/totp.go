@@ -0,0 +1,154 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
+)
+
+// how many recovery codes a user gets, each works once
+const recoveryCodeCount = 10
+
+// TOTP is a user's authenticator app, it only counts once they've confirmed a code from it
+type TOTP struct {
+	UserID    int64
+	Secret    string // base32, authenticator apps need it as is so it can't be hashed
+	Confirmed bool
+	LastStep  int64 // the last time step a code was used for, so codes can't be replayed
+	Created   time.Time
+}
+
+// SQL FUNCTIONS =================================================================================
+
+// GetTOTP looks up the authenticator of t.UserID, confirmed or not
+func (t *TOTP) GetTOTP() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "SELECT * FROM totp WHERE userid=?"
+	serr.Args = append(serr.Args, t.UserID)
+	serr.Err = t.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+	return serr
+}
+
+// SaveTOTP starts enrollment with a new secret, throwing away any unconfirmed one
+func (t *TOTP) SaveTOTP() res.ServerError {
+	var serr res.ServerError
+	t.Confirmed = false
+	t.LastStep = 0
+	t.Created = time.Now()
+	serr.Query = "INSERT INTO totp(userid, secret, confirmed, last_step, created) VALUES(?, ?, FALSE, 0, ?) ON DUPLICATE KEY UPDATE secret=VALUES(secret), confirmed=FALSE, last_step=0, created=VALUES(created)"
+	serr.Args = append(serr.Args, t.UserID, t.Secret, t.Created)
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+// ConfirmTOTP turns on two factor for the user, step is the time step of the code they confirmed with
+func (t *TOTP) ConfirmTOTP(step int64) res.ServerError {
+	var serr res.ServerError
+	serr.Query = "UPDATE totp SET confirmed=TRUE, last_step=? WHERE userid=?"
+	serr.Args = append(serr.Args, step, t.UserID)
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err == nil {
+		t.Confirmed = true
+		t.LastStep = step
+	}
+	return serr
+}
+
+// UseTOTPStep burns the time step of a code that was just accepted. if somebody else used a
+// code from the same step first this fails with sql.ErrNoRows
+func (t *TOTP) UseTOTPStep(step int64) res.ServerError {
+	var serr res.ServerError
+	var result sql.Result
+	serr.Query = "UPDATE totp SET last_step=? WHERE userid=? AND last_step < ?"
+	serr.Args = append(serr.Args, step, t.UserID, step)
+	if result, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		serr.Err = sql.ErrNoRows
+	}
+	t.LastStep = step
+	return serr
+}
+
+// DeleteTOTP turns two factor off, the recovery codes go with it
+func (t *TOTP) DeleteTOTP() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "DELETE FROM recoverycodes WHERE userid=?"
+	serr.Args = append(serr.Args, t.UserID)
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	serr.Query = "DELETE FROM totp WHERE userid=?"
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+// TOTPEnabled reports if the user has to give a code when logging in
+func TOTPEnabled(userID int64) (bool, res.ServerError) {
+	t := TOTP{UserID: userID}
+	serr := t.GetTOTP()
+	if serr.Err == sql.ErrNoRows {
+		serr.Err = nil
+		return false, serr
+	}
+	return t.Confirmed, serr
+}
+
+// CreateRecoveryCodes replaces the user's recovery codes, the plaintext codes are only ever
+// returned here
+func CreateRecoveryCodes(userID int64) ([]string, res.ServerError) {
+	var serr res.ServerError
+	serr.Query = "DELETE FROM recoverycodes WHERE userid=?"
+	serr.Args = append(serr.Args, userID)
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return nil, serr
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for len(codes) < recoveryCodeCount {
+		code, err := util.CreateSecureString(12)
+		if err != nil {
+			serr.Err = err
+			return nil, serr
+		}
+
+		serr.Query = "INSERT INTO recoverycodes(userid, code) VALUES(?, ?)"
+		serr.Args = []interface{}{userID, util.HashToken(code)}
+		if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+			return nil, serr
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, serr
+}
+
+// UseRecoveryCode burns one of the user's recovery codes, sql.ErrNoRows if it isn't one
+func UseRecoveryCode(userID int64, code string) res.ServerError {
+	var serr res.ServerError
+	var result sql.Result
+	serr.Query = "DELETE FROM recoverycodes WHERE userid=? AND code=?"
+	serr.Args = append(serr.Args, userID, util.HashToken(code))
+	if result, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		serr.Err = sql.ErrNoRows
+	}
+	return serr
+}
+
+// HELPER FUNCTIONS ==============================================================================
+
+// scans all totp data into the totp struct
+func (t *TOTP) ScanAll(row *sql.Row) error {
+	return row.Scan(
+		&t.UserID,
+		&t.Secret,
+		&t.Confirmed,
+		&t.LastStep,
+		&t.Created)
+}
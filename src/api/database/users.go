@@ -3,11 +3,13 @@ package database
 import (
 	"database/sql"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
 	"github.com/IWannaCommunity/gate-jump/src/api/res"
 	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
 	jwt "github.com/dgrijalva/jwt-go"
 )
 
@@ -39,10 +41,11 @@ type User struct {
 	// Write: Nobody (by logging into sql only)
 	Banned *bool `json:"banned,omitempty"`
 	// Read: PUBLIC
-	// Write: ADMIN only
+	// Write: Nobody (through CreateBan and LiftBan)
 	Admin *bool `json:"admin,omitempty"`
 	// Read: PUBLIC
 	// Write: Nobody (by logging into sql only)
+	// No longer grants anything, admins are members of a group holding the passport scope
 	LastToken *string `json:"last_token,omitempty"` // ? is this needed
 	// Read: SERVER
 	// Write: SERVER
@@ -61,8 +64,17 @@ type User struct {
 	UUID *string `json:"uuid"`
 	// READ: PUBLIC
 	// WRITE: Nobody
+	PurgeWarned *time.Time `json:"-"`
+	// READ: SERVER
+	// WRITE: SERVER (when the owner is told a deleted account is about to be erased)
+	Purged *time.Time `json:"-"`
+	// READ: SERVER
+	// WRITE: SERVER (once the account is erased, everything but the id and uuid is gone)
 }
 
+// TokenLifetime is how long a token from CreateToken is good for
+const TokenLifetime = time.Hour * 1
+
 type UserList struct {
 	StartIndex int    `json:"startIndex"`      // starting index
 	TotalItems int    `json:"totalItems"`      // how many items are returned
@@ -149,12 +161,7 @@ func (u *User) UpdateUser(auth authentication.Level) res.ServerError {
 	} else {
 		u.Locale = nil
 	}
-	if u.Banned != nil && (auth == authentication.ADMIN) {
-		serr.Query += " banned=?,"
-		serr.Args = append(serr.Args, u.Banned)
-	} else {
-		u.Banned = nil
-	}
+	u.Banned = nil // bans go through CreateBan and LiftBan so there's a record of them
 	if u.LastToken != nil && (auth == authentication.SERVER) {
 		serr.Query += " last_token=?,"
 		serr.Args = append(serr.Args, u.LastToken)
@@ -193,7 +200,7 @@ func (u *User) UpdateUser(auth authentication.Level) res.ServerError {
 
 func (u *User) DeleteUser() res.ServerError {
 	var serr res.ServerError
-	serr.Query = "UPDATE users SET deleted=TRUE, date_deleted=? WHERE id=?"
+	serr.Query = "UPDATE users SET deleted=TRUE, date_deleted=?, purge_warned=NULL WHERE id=?"
 	serr.Args = append(serr.Args, time.Now(), u.ID)
 	_, serr.Err = db.Exec(serr.Query, serr.Args...)
 	return serr
@@ -260,7 +267,32 @@ func (u *User) ScanAll(row *sql.Row) error {
 		&u.LastIP,
 		&u.Deleted,
 		&u.DateDeleted,
-		&u.UUID)
+		&u.UUID,
+		&u.PurgeWarned,
+		&u.Purged)
+}
+
+// runs a query for whole users, as the server sees them
+func queryUsers(serr res.ServerError) ([]User, res.ServerError) {
+	var rows *sql.Rows
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	defer rows.Close()
+
+	users := []User{}
+
+	for rows.Next() {
+		var u User
+		if serr.Err = u.ScanAlls(rows); serr.Err != nil {
+			return nil, serr
+		}
+		users = append(users, u)
+	}
+
+	return users, serr
 }
 
 // scans all user data into the user struct (for rows)
@@ -281,7 +313,9 @@ func (u *User) ScanAlls(rows *sql.Rows) error {
 		&u.LastIP,
 		&u.Deleted,
 		&u.DateDeleted,
-		&u.UUID)
+		&u.UUID,
+		&u.PurgeWarned,
+		&u.Purged)
 }
 
 // applies read user data permissions of a fully retrieved user
@@ -307,31 +341,177 @@ func (u *User) CleanDataRead(auth authentication.Level) {
 	}
 }
 
-func (u *User) CreateToken() (string, error) {
+// TokenOptions describes who a token from CreateToken is being issued to, the zero value
+// is a first party token from /login
+type TokenOptions struct {
+	Audience string // client id of the application the token is for
+	Scope    string // space separated scopes the application was granted, ignored without an audience
+	Session  int64  // id of the login the token belongs to
+}
+
+func (u *User) CreateToken(opts TokenOptions) (string, error) {
+	// give the token an id so it can be revoked before it expires
+	jti, err := util.CreateSecureString(32)
+	if err != nil {
+		return "", err
+	}
+	expires := time.Now().Add(TokenLifetime) //expire in one hour
+	if err = recordToken(jti, &u.ID, nil, expires); err != nil {
+		return "", err
+	}
+
+	// first party tokens carry every scope the user's groups give them
+	if opts.Audience == "" {
+		scopes, serr := GetUserScopes(u.ID)
+		if serr.Err != nil {
+			return "", serr.Err
+		}
+		opts.Scope = strings.Join(scopes, " ")
+	}
+
 	//create and sign the token
 	claims := authentication.Claims{
-		u.ID,
-		u.Name,
-		*u.Admin,
-		u.Country,
-		u.Locale,
-		*u.Verified,
-		*u.Banned,
-		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 1).Unix(), //expire in one hour
-			Issuer:    settings.Host + ":" + settings.Port,
+		ID:       u.ID,
+		Name:     u.Name,
+		Admin:    authentication.HasScope(opts.Scope, authentication.PassportScope),
+		Country:  u.Country,
+		Locale:   u.Locale,
+		Verified: *u.Verified,
+		Banned:   *u.Banned,
+		Scope:    opts.Scope,
+		Session:  opts.Session,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  opts.Audience,
+			ExpiresAt: expires.Unix(),
+			Id:        jti,
+			Issuer:    settings.Issuer,
 			Subject:   strconv.FormatInt(u.ID, 10), //user id as string
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(settings.JwtSecret))
+	return authentication.Sign(claims)
+}
+
+// OpenIDClaims maps the user onto the standard OpenID Connect claims, only releasing
+// the ones the given scopes allow
+func (u *User) OpenIDClaims(scope string) authentication.IDClaims {
+	var claims authentication.IDClaims
+	if u.UUID != nil {
+		claims.Subject = *u.UUID
+	}
+	if authentication.HasScope(scope, "profile") {
+		claims.Name = u.Name
+		claims.Locale = u.Locale
+	}
+	if authentication.HasScope(scope, "email") {
+		claims.Email = u.Email
+		claims.EmailVerified = u.Verified
+	}
+	return claims
+}
+
+// CreateIDToken creates the OpenID Connect id_token handed to an application alongside its access token
+func (u *User) CreateIDToken(clientID, nonce, scope string) (string, error) {
+	now := time.Now()
+	claims := u.OpenIDClaims(scope)
+	claims.Nonce = nonce
+	claims.Audience = clientID
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(TokenLifetime).Unix()
+	claims.Issuer = settings.Issuer
+
+	return authentication.Sign(claims)
 }
 
+// UnflagDeletion restores a deleted account, sql.ErrNoRows means it was erased first
 func (u *User) UnflagDeletion() res.ServerError {
 	var serr res.ServerError
-	serr.Query = "UPDATE users SET deleted=FALSE, date_deleted=NULL WHERE id=?"
+	var result sql.Result
+	serr.Query = "UPDATE users SET deleted=FALSE, date_deleted=NULL, purge_warned=NULL WHERE id=? AND purged IS NULL"
 	serr.Args = append(serr.Args, u.ID)
+	if result, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		serr.Err = sql.ErrNoRows
+	}
+	return serr
+}
+
+// GetUsersToWarn finds the deleted accounts from before deletedBefore whose owners haven't been
+// told yet that they're about to be erased
+func GetUsersToWarn(deletedBefore time.Time) ([]User, res.ServerError) {
+	var serr res.ServerError
+	serr.Query = "SELECT * FROM users WHERE deleted=TRUE AND date_deleted<=? AND purge_warned IS NULL AND purged IS NULL"
+	serr.Args = append(serr.Args, deletedBefore)
+	return queryUsers(serr)
+}
+
+// GetUsersToPurge finds the deleted accounts from before deletedBefore whose owners were warned
+// before warnedBefore
+func GetUsersToPurge(deletedBefore, warnedBefore time.Time) ([]User, res.ServerError) {
+	var serr res.ServerError
+	serr.Query = "SELECT * FROM users WHERE deleted=TRUE AND date_deleted<=? AND purge_warned<=? AND purged IS NULL"
+	serr.Args = append(serr.Args, deletedBefore, warnedBefore)
+	return queryUsers(serr)
+}
+
+func (u *User) MarkPurgeWarned() res.ServerError {
+	var serr res.ServerError
+	now := time.Now()
+	serr.Query = "UPDATE users SET purge_warned=? WHERE id=? AND deleted=TRUE"
+	serr.Args = append(serr.Args, now, u.ID)
 	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	u.PurgeWarned = &now
+	return serr
+}
+
+// PurgeUser erases a deleted account. the row stays so the id and uuid other records point at
+// keep meaning the same nobody, but everything about the person goes, along with what hangs off
+// the account and the addresses in their audit events. it all happens in one transaction holding
+// the account, so a restore either goes first and stops it or waits and finds it erased.
+// sql.ErrNoRows means the account was restored or already erased
+func (u *User) PurgeUser() res.ServerError {
+	var serr res.ServerError
+	var tx *sql.Tx
+
+	if tx, serr.Err = db.Begin(); serr.Err != nil {
+		return serr
+	}
+	defer tx.Rollback() // nothing to undo once it's committed
+
+	serr.Query = "SELECT id FROM users WHERE id=? AND deleted=TRUE AND purged IS NULL FOR UPDATE"
+	serr.Args = append(serr.Args, u.ID)
+	if serr.Err = tx.QueryRow(serr.Query, serr.Args...).Scan(&u.ID); serr.Err != nil {
+		return serr
+	}
+
+	// their tokens expired long before the account could be erased
+	for _, table := range []string{"magic", "logins", "tokens", "memberships", "authcodes", "grants", "totp", "recoverycodes", "mfachallenges", "webauthncredentials", "webauthnchallenges", "bans"} {
+		serr = *new(res.ServerError)
+		serr.Query = "DELETE FROM " + table + " WHERE userid=?"
+		serr.Args = append(serr.Args, u.ID)
+		if _, serr.Err = tx.Exec(serr.Query, serr.Args...); serr.Err != nil {
+			return serr
+		}
+	}
+
+	serr = *new(res.ServerError)
+	serr.Query = "UPDATE audit_events SET ipaddrv4=NULL, ipaddrv6=NULL WHERE actor=? OR target=?"
+	serr.Args = append(serr.Args, u.ID, u.ID)
+	if _, serr.Err = tx.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	// the password can't match anything, so nobody gets back in
+	serr = *new(res.ServerError)
+	serr.Query = "UPDATE users SET name=?, password='', email=NULL, country=NULL, locale=NULL, verified=FALSE, banned=FALSE, last_token=NULL, last_login=NULL, last_ip=NULL, purged=? WHERE id=?"
+	serr.Args = append(serr.Args, "deleted user "+strconv.FormatInt(u.ID, 10), time.Now(), u.ID)
+	if _, serr.Err = tx.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	serr = *new(res.ServerError)
+	serr.Err = tx.Commit()
 	return serr
 }
 
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
+)
+
+// WebAuthnCredential is a passkey or security key a user registered
+type WebAuthnCredential struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"-"`
+	CredentialID []byte     `json:"credential_id"`
+	PublicKey    []byte     `json:"-"` // COSE encoded
+	SignCount    uint32     `json:"-"`
+	Name         string     `json:"name"`
+	Created      time.Time  `json:"created"`
+	LastUsed     *time.Time `json:"last_used,omitempty"`
+}
+
+// WebAuthnChallenge is a challenge handed out for a registration or login, UserID is empty when
+// we don't know who's logging in yet
+type WebAuthnChallenge struct {
+	ID int64
+	// Challenge is the plaintext challenge, only the hash of it is ever stored
+	Challenge string
+	UserID    *int64
+	Purpose   string
+	Expires   time.Time
+}
+
+// SQL FUNCTIONS =================================================================================
+
+func (c *WebAuthnCredential) CreateWebAuthnCredential() res.ServerError {
+	var serr res.ServerError
+	var result sql.Result
+	c.Created = time.Now()
+	serr.Query = "INSERT INTO webauthncredentials(userid, credential_id, public_key, sign_count, name, created) VALUES(?, ?, ?, ?, ?, ?)"
+	serr.Args = append(serr.Args, c.UserID, c.CredentialID, c.PublicKey, c.SignCount, c.Name, c.Created)
+	if result, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+	c.ID, serr.Err = result.LastInsertId()
+	return serr
+}
+
+func (c *WebAuthnCredential) GetWebAuthnCredential() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "SELECT * FROM webauthncredentials WHERE id=?"
+	serr.Args = append(serr.Args, c.ID)
+	serr.Err = c.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+	return serr
+}
+
+// GetWebAuthnCredentialByCredentialID looks up the credential an authenticator says it used
+func (c *WebAuthnCredential) GetWebAuthnCredentialByCredentialID() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "SELECT * FROM webauthncredentials WHERE credential_id=?"
+	serr.Args = append(serr.Args, c.CredentialID)
+	serr.Err = c.ScanAll(db.QueryRow(serr.Query, serr.Args...))
+	return serr
+}
+
+// UseWebAuthnCredential records a login with the credential and its new signature counter
+func (c *WebAuthnCredential) UseWebAuthnCredential(signCount uint32) res.ServerError {
+	var serr res.ServerError
+	now := time.Now()
+	serr.Query = "UPDATE webauthncredentials SET sign_count=?, last_used=? WHERE id=?"
+	serr.Args = append(serr.Args, signCount, now, c.ID)
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err == nil {
+		c.SignCount = signCount
+		c.LastUsed = &now
+	}
+	return serr
+}
+
+func (c *WebAuthnCredential) DeleteWebAuthnCredential() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "DELETE FROM webauthncredentials WHERE id=?"
+	serr.Args = append(serr.Args, c.ID)
+	_, serr.Err = db.Exec(serr.Query, serr.Args...)
+	return serr
+}
+
+// GetWebAuthnCredentials lists the user's credentials, oldest first
+func GetWebAuthnCredentials(userID int64) ([]WebAuthnCredential, res.ServerError) {
+	var serr res.ServerError
+	var rows *sql.Rows
+	serr.Query = "SELECT * FROM webauthncredentials WHERE userid=? ORDER BY id ASC"
+	serr.Args = append(serr.Args, userID)
+	rows, serr.Err = db.Query(serr.Query, serr.Args...)
+
+	if serr.Err != nil {
+		return nil, serr
+	}
+
+	defer rows.Close()
+
+	credentials := []WebAuthnCredential{}
+
+	for rows.Next() {
+		var c WebAuthnCredential
+		if serr.Err = c.ScanAlls(rows); serr.Err != nil {
+			return nil, serr
+		}
+		credentials = append(credentials, c)
+	}
+
+	return credentials, serr
+}
+
+// CreateWebAuthnChallenge stores the challenge, clearing out expired ones while it's at it
+func (c *WebAuthnChallenge) CreateWebAuthnChallenge() res.ServerError {
+	var serr res.ServerError
+	serr.Query = "DELETE FROM webauthnchallenges WHERE expires < ?"
+	serr.Args = append(serr.Args, time.Now())
+	if _, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	var result sql.Result
+	serr.Query = "INSERT INTO webauthnchallenges(challenge, userid, purpose, expires) VALUES(?, ?, ?, ?)"
+	serr.Args = []interface{}{util.HashToken(c.Challenge), c.UserID, c.Purpose, c.Expires}
+	if result, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+	c.ID, serr.Err = result.LastInsertId()
+	return serr
+}
+
+// ConsumeWebAuthnChallenge looks up an unexpired challenge for c.Purpose and deletes it so it
+// can never be answered twice
+func (c *WebAuthnChallenge) ConsumeWebAuthnChallenge() res.ServerError {
+	var serr res.ServerError
+	var hash string
+	serr.Query = "SELECT * FROM webauthnchallenges WHERE challenge=? AND purpose=? AND expires > ?"
+	serr.Args = append(serr.Args, util.HashToken(c.Challenge), c.Purpose, time.Now())
+	serr.Err = db.QueryRow(serr.Query, serr.Args...).Scan(
+		&c.ID,
+		&hash,
+		&c.UserID,
+		&c.Purpose,
+		&c.Expires)
+	if serr.Err != nil {
+		return serr
+	}
+
+	var result sql.Result
+	serr.Query = "DELETE FROM webauthnchallenges WHERE id=?"
+	serr.Args = []interface{}{c.ID}
+	if result, serr.Err = db.Exec(serr.Query, serr.Args...); serr.Err != nil {
+		return serr
+	}
+
+	// somebody else answered it between our select and delete
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		serr.Err = sql.ErrNoRows
+	}
+	return serr
+}
+
+// HELPER FUNCTIONS ==============================================================================
+
+// scans all credential data into the credential struct
+func (c *WebAuthnCredential) ScanAll(row *sql.Row) error {
+	return row.Scan(
+		&c.ID,
+		&c.UserID,
+		&c.CredentialID,
+		&c.PublicKey,
+		&c.SignCount,
+		&c.Name,
+		&c.Created,
+		&c.LastUsed)
+}
+
+// scans all credential data from a set of rows into the credential struct
+func (c *WebAuthnCredential) ScanAlls(rows *sql.Rows) error {
+	return rows.Scan(
+		&c.ID,
+		&c.UserID,
+		&c.CredentialID,
+		&c.PublicKey,
+		&c.SignCount,
+		&c.Name,
+		&c.Created,
+		&c.LastUsed)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
 	"github.com/IWannaCommunity/gate-jump/src/api/database"
 	"github.com/IWannaCommunity/gate-jump/src/api/log"
 	"github.com/IWannaCommunity/gate-jump/src/api/mailer"
@@ -69,6 +70,23 @@ func main() {
 
 	log.Info("Database is successfully attached!")
 
+	// Signing Key Initialization
+	log.Info("Loading Token Signing Keys...")
+
+	err = authentication.InitKeys(database.KeyStore{})
+	if err != nil {
+		log.Fatal("Failed loading signing keys: ", err)
+	}
+
+	go authentication.KeyDaemon()
+	log.Info("Signing Keys loaded, Key Rotation Daemon Started!")
+
+	go authentication.RevocationDaemon()
+	go database.MagicLinkDaemon()
+	go database.BanDaemon()
+	go authentication.ThrottleDaemon()
+	go routers.RetentionDaemon()
+
 	// HTTP Initialization
 	log.Info("Serving API Routes at " + settings.Host + ":" + settings.Port)
 
@@ -0,0 +1,219 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/log"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+)
+
+// how often the daemon clears out buckets that have filled back up
+const sweepInterval = time.Minute * 10
+
+// Policy is how many requests a client gets in a period, they can all be made at once and come
+// back evenly over the period
+type Policy struct {
+	Name     string // buckets are kept apart by policy, so routes with the same policy share them
+	Requests int
+	Per      time.Duration
+	// ByAddress counts requests by address even with a token, for routes where a token doesn't
+	// change who's asking, like signing up or in
+	ByAddress bool
+}
+
+// Result is what taking a request out of a bucket left it at
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until there's room for another request, zero when Allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets, Take has to fill and take from a bucket in one go for a store shared
+// between instances of the service
+type Store interface {
+	Take(key string, policy Policy, now time.Time) (Result, error)
+	Purge(now time.Time) error
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	policy  Policy
+}
+
+// fills the bucket for the time since it was last touched
+func (b *bucket) fill(now time.Time) {
+	rate := float64(b.policy.Requests) / b.policy.Per.Seconds()
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(b.policy.Requests), b.tokens+elapsed*rate)
+		b.updated = now
+	}
+}
+
+func (b *bucket) until(tokens float64) time.Duration {
+	if b.tokens >= tokens {
+		return 0
+	}
+	rate := float64(b.policy.Requests) / b.policy.Per.Seconds()
+	return time.Duration((tokens - b.tokens) / rate * float64(time.Second))
+}
+
+// MemoryStore keeps the buckets in memory, they aren't shared between instances of the service
+type MemoryStore struct {
+	sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewMemoryStore makes an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (m *MemoryStore) Take(key string, policy Policy, now time.Time) (Result, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok || b.policy != policy { // a changed policy starts over with a full bucket
+		b = &bucket{tokens: float64(policy.Requests), updated: now, policy: policy}
+		m.buckets[key] = b
+	}
+	b.fill(now)
+
+	var result Result
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = b.until(1)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = b.until(float64(policy.Requests))
+	return result, nil
+}
+
+// Purge forgets buckets that have filled back up, they'd start out full anyway
+func (m *MemoryStore) Purge(now time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	for key, b := range m.buckets {
+		b.fill(now)
+		if b.tokens >= float64(b.policy.Requests) {
+			delete(m.buckets, key)
+		}
+	}
+	return nil
+}
+
+type route struct {
+	prefix string
+	policy Policy
+}
+
+// Limiter hands every client a token bucket per policy, picking the policy by the request's path.
+// requests that find their bucket empty are turned away until it fills back up
+type Limiter struct {
+	store    Store
+	fallback Policy
+	routes   []route
+	// IP finds the address of the client, for requests without a token
+	IP func(r *http.Request) net.IP
+}
+
+// New makes a Limiter that holds requests to paths without a policy of their own to fallback
+func New(store Store, fallback Policy) *Limiter {
+	return &Limiter{store: store, fallback: fallback, IP: remoteIP}
+}
+
+// Route gives paths starting with prefix their own policy, the longest matching prefix wins
+func (l *Limiter) Route(prefix string, policy Policy) *Limiter {
+	l.routes = append(l.routes, route{prefix: prefix, policy: policy})
+	sort.SliceStable(l.routes, func(i, j int) bool { return len(l.routes[i].prefix) > len(l.routes[j].prefix) })
+	return l
+}
+
+// Policy is the policy for path
+func (l *Limiter) Policy(path string) Policy {
+	for _, rt := range l.routes {
+		if path == rt.prefix || strings.HasPrefix(path, strings.TrimRight(rt.prefix, "/")+"/") {
+			return rt.policy
+		}
+	}
+	return l.fallback
+}
+
+// Daemon keeps the buckets from growing forever
+func (l *Limiter) Daemon() {
+	for range time.Tick(sweepInterval) {
+		if err := l.store.Purge(time.Now()); err != nil {
+			log.Error("Could not purge rate limit buckets, %v", err)
+		}
+	}
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// who the request counts against under policy, signed in users and applications are counted
+// wherever they come from, everybody else by their address. the token is only checked for being
+// ours, so one that was signed out still counts against whoever it belonged to
+func (l *Limiter) client(r *http.Request, policy Policy) string {
+	if policy.ByAddress {
+		return "ip:" + l.IP(r).String()
+	}
+	if claims, ok := authentication.PeekToken(authentication.BearerToken(r)); ok {
+		if claims.ID != 0 {
+			return "user:" + strconv.FormatInt(claims.ID, 10)
+		}
+		if claims.Client != "" {
+			return "client:" + claims.Client
+		}
+	}
+	return "ip:" + l.IP(r).String()
+}
+
+// seconds rounded up, so clients never come back too early
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Middleware turns away requests once the client's bucket for the route is empty. it should
+// run ahead of JWTContext, so tokens that get turned away are counted too and stop costing
+// lookups once their bucket is empty
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := l.Policy(r.URL.Path)
+		result, err := l.store.Take(policy.Name+":"+l.client(r, policy), policy, time.Now())
+		if err != nil { // better to let everyone through than nobody
+			log.Error("Could not check the rate limit, %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.Requests))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", seconds(result.Reset))
+		if !result.Allowed {
+			w.Header().Set("Retry-After", seconds(result.RetryAfter))
+			res.New(http.StatusTooManyRequests).SetErrorMessage("Too Many Requests").Error(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,134 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	store := NewMemoryStore()
+	policy := Policy{Name: "test", Requests: 3, Per: time.Minute}
+	now := time.Now()
+
+	for i := 2; i >= 0; i-- {
+		result, err := store.Take("client", policy, now)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+
+	result, _ := store.Take("client", policy, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 20*time.Second, result.RetryAfter)
+	assert.Equal(t, time.Minute, result.Reset)
+
+	// a request comes back every 20 seconds
+	result, _ = store.Take("client", policy, now.Add(20*time.Second))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// somebody else has their own bucket
+	result, _ = store.Take("someone else", policy, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+
+	// full buckets are forgotten, they'd start out full anyway
+	assert.NoError(t, store.Purge(now.Add(time.Minute)))
+	assert.Len(t, store.buckets, 1)
+	assert.NoError(t, store.Purge(now.Add(2*time.Minute)))
+	assert.Empty(t, store.buckets)
+}
+
+func TestRoutePolicies(t *testing.T) {
+	fallback := Policy{Name: "default", Requests: 100, Per: time.Minute}
+	login := Policy{Name: "login", Requests: 5, Per: time.Minute}
+	mfa := Policy{Name: "mfa", Requests: 2, Per: time.Minute}
+	l := New(NewMemoryStore(), fallback).Route("/login", login).Route("/login/mfa", mfa)
+
+	assert.Equal(t, login, l.Policy("/login"))
+	assert.Equal(t, login, l.Policy("/login/webauthn"))
+	assert.Equal(t, mfa, l.Policy("/login/mfa"))
+	assert.Equal(t, fallback, l.Policy("/loginx"))
+	assert.Equal(t, fallback, l.Policy("/user/1"))
+}
+
+func TestMiddleware(t *testing.T) {
+	settings.Keys.Algorithm = "ES256"
+	settings.Keys.Rotation = time.Hour * 24
+	l := New(NewMemoryStore(), Policy{Name: "default", Requests: 100, Per: time.Minute}).
+		Route("/login", Policy{Name: "login", Requests: 2, Per: time.Minute}).
+		Route("/session", Policy{Name: "session", Requests: 2, Per: time.Minute}).
+		Route("/register", Policy{Name: "register", Requests: 2, Per: time.Minute, ByAddress: true})
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serveToken := func(path, addr, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, nil)
+		r.RemoteAddr = addr
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	serve := func(path, addr string, claims *authentication.Claims) *httptest.ResponseRecorder {
+		var token string
+		if claims != nil {
+			claims.ExpiresAt = time.Now().Add(time.Hour).Unix()
+			signed, err := authentication.Sign(claims)
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			token = signed
+		}
+		return serveToken(path, addr, token)
+	}
+
+	w := serve("/login", "192.0.2.1:5000", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+
+	// the port doesn't make it somebody else
+	assert.Equal(t, http.StatusOK, serve("/login", "192.0.2.1:5001", nil).Code)
+	w = serve("/login", "192.0.2.1:5002", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	var payload struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&payload))
+	assert.False(t, payload.Success)
+	assert.Equal(t, "Too Many Requests", payload.Error)
+
+	// other routes and other addresses have their own buckets
+	assert.Equal(t, http.StatusOK, serve("/user/1", "192.0.2.1:5003", nil).Code)
+	assert.Equal(t, http.StatusOK, serve("/login", "192.0.2.2:5000", nil).Code)
+
+	// signed in users are counted by who they are, not where they are
+	user := &authentication.Claims{ID: 7}
+	assert.Equal(t, http.StatusOK, serve("/session", "192.0.2.1:5004", user).Code)
+	assert.Equal(t, http.StatusOK, serve("/session", "192.0.2.3:5000", user).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/session", "192.0.2.4:5000", user).Code)
+
+	// a token we didn't sign doesn't make it somebody else
+	assert.Equal(t, http.StatusOK, serveToken("/session", "192.0.2.5:5000", "not a token").Code)
+	assert.Equal(t, http.StatusOK, serveToken("/session", "192.0.2.5:5000", "another one").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serveToken("/session", "192.0.2.5:5000", "a third").Code)
+
+	// some routes are counted by address whoever is signed in
+	assert.Equal(t, http.StatusOK, serve("/register", "192.0.2.6:5000", &authentication.Claims{ID: 8}).Code)
+	assert.Equal(t, http.StatusOK, serve("/register", "192.0.2.6:5000", &authentication.Claims{ID: 9}).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/register", "192.0.2.6:5000", &authentication.Claims{ID: 10}).Code)
+}
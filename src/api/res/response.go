@@ -17,8 +17,30 @@ type Response struct {
 		Success  bool        `json:"success"`
 		Error    *string     `json:"error,omitempty"`
 		Token    *string     `json:"token,omitempty"`
+		Refresh  *string     `json:"refresh_token,omitempty"`
 		User     interface{} `json:"user,omitempty"`
 		UserList interface{} `json:"userList,omitempty"`
+		Redirect *string     `json:"redirect,omitempty"`
+
+		MFARequired   bool        `json:"mfa_required,omitempty"`
+		MFAMethods    []string    `json:"mfa_methods,omitempty"`
+		Challenge     *string     `json:"challenge,omitempty"`
+		WebAuthn      interface{} `json:"publicKey,omitempty"`
+		Credential    interface{} `json:"credential,omitempty"`
+		Credentials   interface{} `json:"credentials,omitempty"`
+		TOTP          interface{} `json:"totp,omitempty"`
+		RecoveryCodes []string    `json:"recovery_codes,omitempty"`
+
+		Sessions        interface{} `json:"sessions,omitempty"`
+		Grants          interface{} `json:"grants,omitempty"`
+		Application     interface{} `json:"application,omitempty"`
+		ApplicationList interface{} `json:"applicationList,omitempty"`
+		Scope           interface{} `json:"scope,omitempty"`
+		ScopeList       interface{} `json:"scopeList,omitempty"`
+		Group           interface{} `json:"group,omitempty"`
+		GroupList       interface{} `json:"groupList,omitempty"`
+		AuditEventList  interface{} `json:"auditEventList,omitempty"`
+		Ban             interface{} `json:"ban,omitempty"`
 	}
 	InternalError *ServerError
 }
@@ -51,10 +73,84 @@ func (r *Response) SetUsers(datas interface{}) *Response {
 	r.Payload.UserList = datas
 	return r
 }
+func (r *Response) SetSessions(datas interface{}) *Response {
+	r.Payload.Sessions = datas
+	return r
+}
+func (r *Response) SetGrants(datas interface{}) *Response {
+	r.Payload.Grants = datas
+	return r
+}
+func (r *Response) SetAuditEvents(datas interface{}) *Response {
+	r.Payload.AuditEventList = datas
+	return r
+}
+func (r *Response) SetBan(data interface{}) *Response {
+	r.Payload.Ban = data
+	return r
+}
+func (r *Response) SetApplication(data interface{}) *Response {
+	r.Payload.Application = data
+	return r
+}
+func (r *Response) SetApplications(datas interface{}) *Response {
+	r.Payload.ApplicationList = datas
+	return r
+}
+func (r *Response) SetScope(data interface{}) *Response {
+	r.Payload.Scope = data
+	return r
+}
+func (r *Response) SetScopes(datas interface{}) *Response {
+	r.Payload.ScopeList = datas
+	return r
+}
+func (r *Response) SetGroup(data interface{}) *Response {
+	r.Payload.Group = data
+	return r
+}
+func (r *Response) SetGroups(datas interface{}) *Response {
+	r.Payload.GroupList = datas
+	return r
+}
 func (r *Response) SetToken(token string) *Response {
 	r.Payload.Token = &token
 	return r
 }
+func (r *Response) SetRefreshToken(token string) *Response {
+	r.Payload.Refresh = &token
+	return r
+}
+func (r *Response) SetChallenge(challenge string, methods []string) *Response {
+	r.Payload.MFARequired = true
+	r.Payload.MFAMethods = methods
+	r.Payload.Challenge = &challenge
+	return r
+}
+func (r *Response) SetWebAuthnOptions(data interface{}) *Response {
+	r.Payload.WebAuthn = data
+	return r
+}
+func (r *Response) SetCredential(data interface{}) *Response {
+	r.Payload.Credential = data
+	return r
+}
+func (r *Response) SetCredentials(datas interface{}) *Response {
+	r.Payload.Credentials = datas
+	return r
+}
+func (r *Response) SetTOTP(data interface{}) *Response {
+	r.Payload.TOTP = data
+	return r
+}
+func (r *Response) SetRecoveryCodes(codes []string) *Response {
+	r.Payload.RecoveryCodes = codes
+	return r
+}
+func (r *Response) SetRedirect(uri string) *Response {
+	r.Payload.Redirect = &uri
+	return r
+}
 
 func (r *Response) SetErrorMessage(message string) *Response {
 	r.Payload.Error = &message
@@ -0,0 +1,333 @@
+package routers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// generates a new client secret, returning the plaintext and the hash to store
+func createClientSecret() (string, string, error) {
+	secret, err := util.CreateSecureString(48)
+	if err != nil {
+		return "", "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), 12)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, string(hash), nil
+}
+
+// looks up the application from the id in the url
+func applicationFromRequest(r *http.Request) (database.Application, *res.Response) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return database.Application{}, res.New(http.StatusBadRequest).SetErrorMessage("Invalid Application ID")
+	}
+
+	a := database.Application{ID: int64(id)}
+	if serr := a.GetApplication(); serr.Err == sql.ErrNoRows {
+		return a, res.New(http.StatusNotFound).SetErrorMessage("Application Not Found")
+	} else if serr.Err != nil {
+		return a, res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	return a, nil
+}
+
+// applications acting as themselves carry their scopes in their tokens, once those change
+// or the application is compromised the tokens have to go
+func revokeClientTokens(appIDs ...int64) *res.Response {
+	for _, id := range appIDs {
+		if err := authentication.RevokeClient(id); err != nil {
+			return res.New(http.StatusInternalServerError).SetInternalError(&res.ServerError{Err: err})
+		}
+	}
+	return nil
+}
+
+// register an application
+func createApplication(w http.ResponseWriter, r *http.Request) {
+	var a database.Application
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&a); err != nil || a.Name == nil || a.RedirectURI == nil {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	if *a.Name == "" {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Application Name").Error(w)
+		return
+	}
+
+	if a.Type == nil {
+		a.Type = &[]string{database.APPCONFIDENTIAL}[0]
+	}
+	if *a.Type != database.APPCONFIDENTIAL && *a.Type != database.APPPUBLIC {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Application Type").Error(w)
+		return
+	}
+
+	if !util.IsValidRedirectURI(*a.RedirectURI) {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Redirect URI").Error(w)
+		return
+	}
+
+	strID, err := util.CreateSecureString(32)
+	if err != nil {
+		res.New(http.StatusInternalServerError).SetErrorMessage("Failed Creating Client ID").Error(w)
+		return
+	}
+	a.StrID = &strID
+
+	// public applications can't keep a secret, so they don't get one
+	var secret string
+	a.Secret = nil
+	if !a.IsPublic() {
+		var hash string
+		if secret, hash, err = createClientSecret(); err != nil {
+			res.New(http.StatusInternalServerError).SetErrorMessage("Failed Creating Client Secret").Error(w)
+			return
+		}
+		a.Secret = &hash
+	}
+
+	if serr := a.CreateApplication(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditApplication, Detail: "created " + *a.StrID})
+
+	// this is the only time the plaintext secret is ever handed out
+	a.CleanDataRead()
+	if secret != "" {
+		a.Secret = &secret
+	}
+
+	res.New(http.StatusCreated).SetApplication(a).JSON(w)
+}
+
+// get multiple
+func getApplications(w http.ResponseWriter, r *http.Request) {
+	count, _ := strconv.Atoi(r.FormValue("count"))
+	start, _ := strconv.Atoi(r.FormValue("start"))
+
+	if count > 50 {
+		count = 50
+	} else if count < 0 {
+		count = 0
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	apps, serr := database.GetApplications(start, count)
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	res.New(http.StatusOK).SetApplications(apps).JSON(w)
+}
+
+// get
+func getApplication(w http.ResponseWriter, r *http.Request) {
+	a, response := applicationFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if serr := a.GetScopes(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	a.CleanDataRead()
+	res.New(http.StatusOK).SetApplication(a).JSON(w)
+}
+
+// update
+func updateApplication(w http.ResponseWriter, r *http.Request) {
+	a, response := applicationFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	var update database.Application
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&update); err != nil {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	// the client id and type never change, and secrets are rotated through their own route
+	update.ID = a.ID
+	update.StrID = nil
+	update.Type = nil
+	update.Secret = nil
+
+	if update.Name != nil && *update.Name == "" {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Application Name").Error(w)
+		return
+	}
+	if update.RedirectURI != nil && !util.IsValidRedirectURI(*update.RedirectURI) {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Redirect URI").Error(w)
+		return
+	}
+
+	if serr := update.UpdateApplication(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	if serr := a.GetApplication(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditApplication, Detail: "updated " + *a.StrID})
+
+	a.CleanDataRead()
+	res.New(http.StatusOK).SetApplication(a).JSON(w)
+}
+
+// rotate the client secret, the old one stops working immediately
+func rotateApplicationSecret(w http.ResponseWriter, r *http.Request) {
+	a, response := applicationFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if a.IsPublic() {
+		res.New(http.StatusBadRequest).SetErrorMessage("Public Applications Have No Secret").Error(w)
+		return
+	}
+
+	secret, hash, err := createClientSecret()
+	if err != nil {
+		res.New(http.StatusInternalServerError).SetErrorMessage("Failed Creating Client Secret").Error(w)
+		return
+	}
+
+	update := database.Application{ID: a.ID, Secret: &hash}
+	if serr := update.UpdateApplication(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if response := revokeClientTokens(a.ID); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditApplication, Detail: "rotated the secret of " + *a.StrID})
+
+	a.Secret = &secret
+	res.New(http.StatusOK).SetApplication(a).JSON(w)
+}
+
+// delete
+func deleteApplication(w http.ResponseWriter, r *http.Request) {
+	a, response := applicationFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if serr := a.DeleteApplication(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if response := revokeClientTokens(a.ID); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditApplication, Detail: "deleted " + *a.StrID})
+
+	res.New(http.StatusAccepted).JSON(w)
+}
+
+// looks up the application and the scope from the ids in the url
+func applicationScopeFromRequest(r *http.Request) (database.Application, database.Scope, *res.Response) {
+	a, response := applicationFromRequest(r)
+	if response != nil {
+		return a, database.Scope{}, response
+	}
+
+	vars := mux.Vars(r)
+	sid, err := strconv.Atoi(vars["sid"])
+	if err != nil {
+		return a, database.Scope{}, res.New(http.StatusBadRequest).SetErrorMessage("Invalid Scope ID")
+	}
+
+	s := database.Scope{ID: int64(sid)}
+	if serr := s.GetScope(); serr.Err == sql.ErrNoRows {
+		return a, s, res.New(http.StatusNotFound).SetErrorMessage("Scope Not Found")
+	} else if serr.Err != nil {
+		return a, s, res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	return a, s, nil
+}
+
+// assign a scope the application gets when acting as itself
+func attachApplicationScope(w http.ResponseWriter, r *http.Request) {
+	a, s, response := applicationScopeFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if serr := a.AddScope(s.ID); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if response := revokeClientTokens(a.ID); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditApplication, Detail: "gave " + *a.StrID + " " + *s.Name})
+
+	if serr := a.GetScopes(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	a.CleanDataRead()
+	res.New(http.StatusOK).SetApplication(a).JSON(w)
+}
+
+// take a scope away from the application
+func detachApplicationScope(w http.ResponseWriter, r *http.Request) {
+	a, s, response := applicationScopeFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if serr := a.RemoveScope(s.ID); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if response := revokeClientTokens(a.ID); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditApplication, Detail: "took " + *s.Name + " from " + *a.StrID})
+
+	if serr := a.GetScopes(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	a.CleanDataRead()
+	res.New(http.StatusOK).SetApplication(a).JSON(w)
+}
@@ -0,0 +1,71 @@
+package routers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/log"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+)
+
+// records an event in the audit log. the actor is whoever the token belongs to unless the event
+// already says, like on logins where there's no token yet. a failure to record doesn't fail the
+// request, it's logged instead
+func audit(r *http.Request, e database.AuditEvent) {
+	if ctx, ok := r.Context().Value(authentication.CLAIMS).(authentication.Context); ok && e.Actor == nil && e.Client == nil {
+		if ctx.Claims.ID != 0 {
+			e.Actor = &ctx.Claims.ID
+		}
+		if ctx.Claims.Client != "" {
+			e.Client = &ctx.Claims.Client
+		}
+	}
+	e.IP = requestIP(r)
+
+	if serr := e.CreateAuditEvent(); serr.Err != nil {
+		log.Error("Could not record a %s audit event, %v", e.Type, serr.Err)
+	}
+}
+
+// look through the audit log, newest first
+func getAuditEvents(w http.ResponseWriter, r *http.Request) {
+	count, _ := strconv.Atoi(r.FormValue("count"))
+	start, _ := strconv.Atoi(r.FormValue("start"))
+
+	if count > 100 || count <= 0 {
+		count = 100
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	var filter database.AuditFilter
+	if user := r.FormValue("user"); user != "" {
+		id, err := strconv.ParseInt(user, 10, 64)
+		if err != nil {
+			res.New(http.StatusBadRequest).SetErrorMessage("Invalid User ID").Error(w)
+			return
+		}
+		filter.User = &id
+	}
+	filter.Type = r.FormValue("type")
+	if since := r.FormValue("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			res.New(http.StatusBadRequest).SetErrorMessage("Invalid Since").Error(w)
+			return
+		}
+		filter.Since = &t
+	}
+
+	events, serr := database.GetAuditEvents(filter, start, count)
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	res.New(http.StatusOK).SetAuditEvents(events).JSON(w)
+}
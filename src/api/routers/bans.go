@@ -0,0 +1,164 @@
+package routers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/mailer"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+	smtp "github.com/go-mail/mail"
+	"github.com/gorilla/mux"
+)
+
+// how dates are written out in mails
+const mailDateFormat = "January 2, 2006 at 15:04 MST"
+
+// BanRequest is the request expected on POST /user/{id}/ban
+type BanRequest struct {
+	Reason  string     `json:"reason"`
+	Expires *time.Time `json:"expires"` // banned until lifted when empty
+}
+
+// looks up the user from the id in the url
+func banTarget(r *http.Request) (database.User, *res.Response) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return database.User{}, res.New(http.StatusBadRequest).SetErrorMessage("Invalid User ID")
+	}
+
+	u := database.User{ID: int64(id)}
+	if serr := u.GetUser(authentication.SERVER); serr.Err == sql.ErrNoRows {
+		return u, res.New(http.StatusNotFound).SetErrorMessage("User Not Found")
+	} else if serr.Err != nil {
+		return u, res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	return u, nil
+}
+
+// the response for a banned user trying to get in, saying why and until when. a temporary ban
+// that already ran out is lifted here instead of waiting on the daemon
+func checkBan(r *http.Request, u *database.User) *res.Response {
+	if u.Banned == nil || !*u.Banned {
+		return nil
+	}
+
+	ban := database.Ban{UserID: u.ID}
+	if serr := ban.GetActiveBan(); serr.Err == sql.ErrNoRows { // banned before reasons were kept
+		return res.New(http.StatusUnauthorized).SetErrorMessage("Account Banned")
+	} else if serr.Err != nil {
+		return res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	if ban.Active(time.Now()) {
+		return res.New(http.StatusUnauthorized).SetErrorMessage("Account Banned").SetBan(ban)
+	}
+
+	if serr := database.LiftBan(u.ID, nil); serr.Err == nil {
+		audit(r, database.AuditEvent{Type: database.AuditUnban, Target: &u.ID, Detail: "ban expired"})
+	} else if serr.Err != sql.ErrNoRows {
+		return res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	u.Banned = &[]bool{false}[0]
+	return nil
+}
+
+// ban a user, signing them out everywhere
+func banUser(w http.ResponseWriter, r *http.Request) {
+	u, response := banTarget(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	var br BanRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&br); err != nil {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	br.Reason = strings.TrimSpace(br.Reason)
+	if br.Reason == "" || len(br.Reason) > 500 {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Ban Reason").Error(w)
+		return
+	}
+	if br.Expires != nil && !br.Expires.After(time.Now()) {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Ban Expiry").Error(w)
+		return
+	}
+
+	ban := database.Ban{UserID: u.ID, Reason: br.Reason, Expires: br.Expires}
+	ctx := r.Context().Value(authentication.CLAIMS).(authentication.Context)
+	if ctx.Claims.ID != 0 {
+		ban.BannedBy = &ctx.Claims.ID
+	}
+	if serr := ban.CreateBan(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if response := revokeUser(u.ID); response != nil {
+		response.Error(w)
+		return
+	}
+
+	until := "until further notice"
+	detail := ban.Reason
+	if ban.Expires != nil {
+		until = "until " + ban.Expires.UTC().Format(mailDateFormat)
+		detail += ", until " + ban.Expires.UTC().Format(time.RFC3339)
+	}
+	audit(r, database.AuditEvent{Type: database.AuditBan, Target: &u.ID, Detail: detail})
+
+	if u.Email != nil {
+		msg := smtp.NewMessage()
+		msg.SetHeader("From", settings.Mailer.User)
+		msg.SetHeader("To", *u.Email)
+		msg.SetHeader("Subject", "Your I Wanna Community Account Was Banned")
+		msg.SetBody("text/plain", "Your account "+*u.Name+" has been banned "+until+" and you've been signed out everywhere.\n\nReason: "+ban.Reason)
+		mailer.Outbox <- msg
+	}
+
+	res.New(http.StatusCreated).SetBan(ban).JSON(w)
+}
+
+// lift a user's ban early
+func unbanUser(w http.ResponseWriter, r *http.Request) {
+	u, response := banTarget(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	var liftedBy *int64
+	ctx := r.Context().Value(authentication.CLAIMS).(authentication.Context)
+	if ctx.Claims.ID != 0 {
+		liftedBy = &ctx.Claims.ID
+	}
+	if serr := database.LiftBan(u.ID, liftedBy); serr.Err == sql.ErrNoRows {
+		res.New(http.StatusNotFound).SetErrorMessage("User Not Banned").Error(w)
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditUnban, Target: &u.ID})
+
+	if u.Email != nil {
+		msg := smtp.NewMessage()
+		msg.SetHeader("From", settings.Mailer.User)
+		msg.SetHeader("To", *u.Email)
+		msg.SetHeader("Subject", "Your I Wanna Community Account Was Unbanned")
+		msg.SetBody("text/plain", "The ban on your account "+*u.Name+" has been lifted, you can sign in again.")
+		mailer.Outbox <- msg
+	}
+
+	res.New(http.StatusAccepted).JSON(w)
+}
@@ -0,0 +1,74 @@
+package routers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBanUser(t *testing.T) {
+	u := prepareTestUser(t)
+	admin := registerTestUser(t, "admin_user", "admin@website.com")
+	passport := database.Group{Name: &[]string{"passport"}[0]}
+	if serr := passport.GetGroupByName(); serr.Err != nil {
+		t.Fatal(serr.Err)
+	}
+	if serr := passport.AddMember(admin.ID); serr.Err != nil {
+		t.Fatal(serr.Err)
+	}
+
+	userToken, err := u.CreateToken(database.TokenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminToken, err := admin.CreateToken(database.TokenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	te.Target("POST", fmt.Sprintf("/user/%d/ban", u.ID))
+	assertError(t, te.Request([]byte(`{"reason":"spam"}`)), http.StatusUnauthorized, "Login Required")
+
+	te.Authorize(userToken)
+	assertError(t, te.Request([]byte(`{"reason":"spam"}`)), http.StatusForbidden, "Invalid Permissions")
+
+	te.Authorize(adminToken)
+	assertError(t, te.Request([]byte(`{"reason":"   "}`)), http.StatusBadRequest, "Invalid Ban Reason")
+	r := te.Request([]byte(`{"reason":"spam"}`))
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusCreated, r.Code, te.Expect())
+		assert.True(t, r.Response.Success, te.Expect())
+	}
+	if serr := u.GetUser(authentication.SERVER); assert.NoError(t, serr.Err) {
+		assert.True(t, *u.Banned)
+	}
+
+	// the right password doesn't get them in
+	te.Authorize("")
+	te.Target("POST", "/login")
+	assertError(t, te.Request([]byte(`{"username":"test_user","password":"12345678"}`)), http.StatusUnauthorized, "Account Banned")
+
+	te.Authorize(adminToken)
+	te.Target("DELETE", fmt.Sprintf("/user/%d/ban", u.ID))
+	r = te.Request(nil)
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusAccepted, r.Code, te.Expect())
+		assert.True(t, r.Response.Success, te.Expect())
+	}
+	assertError(t, te.Request(nil), http.StatusNotFound, "User Not Banned")
+
+	te.Authorize("")
+	te.Target("POST", "/login")
+	r = te.Request([]byte(`{"username":"test_user","password":"12345678"}`))
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusOK, r.Code, te.Expect())
+		assert.NotNil(t, r.Response.Token, te.Expect())
+	}
+}
@@ -0,0 +1,134 @@
+package routers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/mailer"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
+	smtp "github.com/go-mail/mail"
+)
+
+const (
+	// how long the new address has to confirm the change
+	emailChangeLinkLifetime = time.Hour * 24
+	// how long the old address can take the account back, long enough to notice a change they didn't make
+	emailUndoLinkLifetime = time.Hour * 24 * 7
+	// how many changes can be asked for by a user or sent to an address in emailChangeWindow
+	emailChangeLimit  = 3
+	emailChangeWindow = time.Hour
+)
+
+// makes a magic link for the user sent to email and returns it
+func createEmailLink(userID int64, email, purpose string, lifetime time.Duration) (database.MagicLink, res.ServerError) {
+	magic, err := util.CreateSecureString(32)
+	if err != nil {
+		return database.MagicLink{}, res.ServerError{Err: err}
+	}
+	ml := database.MagicLink{UserID: userID, Magic: magic, Purpose: purpose, Email: email, ExpiresAt: time.Now().Add(lifetime)}
+	return ml, ml.CreateMagicLink()
+}
+
+// starts moving the user from oldEmail to newEmail, the new address gets a link to confirm it and
+// the old one gets a link to undo it. nothing changes until the confirmation link is used
+func requestEmailChange(u database.User, oldEmail, newEmail string) res.ServerError {
+	// only the newest change can be confirmed
+	if serr := database.ExpireMagicLinks(u.ID, database.MagicEmail); serr.Err != nil {
+		return serr
+	}
+
+	confirm, serr := createEmailLink(u.ID, newEmail, database.MagicEmail, emailChangeLinkLifetime)
+	if serr.Err != nil {
+		return serr
+	}
+	undo, serr := createEmailLink(u.ID, oldEmail, database.MagicUndo, emailUndoLinkLifetime)
+	if serr.Err != nil {
+		return serr
+	}
+
+	msg := smtp.NewMessage()
+	msg.SetHeader("From", settings.Mailer.User)
+	msg.SetHeader("To", newEmail)
+	msg.SetHeader("Subject", "Confirm Your New Email for I Wanna Community")
+	msg.SetBody("text/plain", `Somebody asked to move their I Wanna Community account to this address.
+If it was you, confirm it by following the link below, it works for a day.
+
+`+settings.Issuer+`/email/confirm/`+confirm.Magic)
+	mailer.Outbox <- msg
+
+	msg = smtp.NewMessage()
+	msg.SetHeader("From", settings.Mailer.User)
+	msg.SetHeader("To", oldEmail)
+	msg.SetHeader("Subject", "Your I Wanna Community Email Is Changing")
+	msg.SetBody("text/plain", `Somebody asked to move your I Wanna Community account to `+newEmail+`.
+If it wasn't you, follow the link below to keep this address and sign out everywhere, it works for a week.
+
+`+settings.Issuer+`/email/undo/`+undo.Magic)
+	mailer.Outbox <- msg
+
+	return res.ServerError{}
+}
+
+// uses an email change link, unless somebody took the address since the link was sent
+func useEmailLink(w http.ResponseWriter, r *http.Request, purpose string) (database.MagicLink, bool) {
+	return useMagicLink(w, r, purpose, func(ml database.MagicLink) *res.Response {
+		other := database.User{Email: &ml.Email}
+		if serr := other.GetUserByEmail(authentication.SERVER); serr.Err == nil && other.ID != ml.UserID {
+			return res.New(http.StatusConflict).SetErrorMessage("Email Already In Use")
+		} else if serr.Err != nil && serr.Err != sql.ErrNoRows {
+			return res.New(http.StatusInternalServerError).SetInternalError(&serr)
+		}
+		return nil
+	})
+}
+
+// moves the user to the address the link was sent to, getting it proves they own it
+func confirmEmail(w http.ResponseWriter, r *http.Request) {
+	ml, ok := useEmailLink(w, r, database.MagicEmail)
+	if !ok {
+		return
+	}
+
+	u := database.User{ID: ml.UserID, Email: &ml.Email, Verified: &[]bool{true}[0]}
+	if serr := u.UpdateUser(authentication.SERVER); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditEmailChange, Actor: &u.ID, Target: &u.ID, Detail: "confirmed"})
+
+	res.New(http.StatusAccepted).JSON(w)
+}
+
+// moves the user back to the address they were on, whoever changed it may have been in their
+// account so they're signed out everywhere
+func undoEmail(w http.ResponseWriter, r *http.Request) {
+	ml, ok := useEmailLink(w, r, database.MagicUndo)
+	if !ok {
+		return
+	}
+
+	// a change that hasn't been confirmed yet is called off
+	if serr := database.ExpireMagicLinks(ml.UserID, database.MagicEmail); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	u := database.User{ID: ml.UserID, Email: &ml.Email, Verified: &[]bool{true}[0]}
+	if serr := u.UpdateUser(authentication.SERVER); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	if response := revokeUser(u.ID); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditEmailChange, Actor: &u.ID, Target: &u.ID, Detail: "undone"})
+
+	res.New(http.StatusAccepted).JSON(w)
+}
@@ -0,0 +1,102 @@
+package routers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailLinks(t *testing.T) {
+	u := prepareTestUser(t)
+	registerTestUser(t, "other_user", "taken@website.com")
+	createTestLink(t, u, "confirm_link", database.MagicEmail, "new@website.com", false)
+	createTestLink(t, u, "taken_link", database.MagicEmail, "taken@website.com", false)
+	createTestLink(t, u, "undo_link", database.MagicUndo, "email@website.com", false)
+
+	te.Target("GET", "/email/confirm/no_such_link")
+	assertError(t, te.Request(nil), http.StatusNotFound, "Link Not Found")
+
+	// a link only works for what it was sent for
+	te.Target("GET", "/email/confirm/undo_link")
+	assertError(t, te.Request(nil), http.StatusNotFound, "Link Not Found")
+
+	te.Target("GET", "/email/confirm/taken_link")
+	assertError(t, te.Request(nil), http.StatusConflict, "Email Already In Use")
+
+	te.Target("GET", "/email/confirm/confirm_link")
+	r := te.Request(nil)
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusAccepted, r.Code, te.Expect())
+		assert.True(t, r.Response.Success, te.Expect())
+	}
+	if serr := u.GetUser(authentication.SERVER); assert.NoError(t, serr.Err) {
+		assert.Equal(t, "new@website.com", *u.Email)
+	}
+	assertError(t, te.Request(nil), http.StatusGone, "Link Expired")
+
+	// the old address can take it back
+	te.Target("GET", "/email/undo/undo_link")
+	r = te.Request(nil)
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusAccepted, r.Code, te.Expect())
+		assert.True(t, r.Response.Success, te.Expect())
+	}
+	if serr := u.GetUser(authentication.SERVER); assert.NoError(t, serr.Err) {
+		assert.Equal(t, "email@website.com", *u.Email)
+	}
+	assertError(t, te.Request(nil), http.StatusGone, "Link Expired")
+}
+
+func TestEmailChangeLimit(t *testing.T) {
+	u := prepareTestUser(t)
+	token, err := u.CreateToken(database.TokenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	te.Authorize(token)
+	te.Target("PUT", fmt.Sprintf("/user/%d", u.ID))
+	for i := 0; i < emailChangeLimit; i++ {
+		r := te.Request([]byte(fmt.Sprintf(`{"email":"new%d@website.com"}`, i)))
+		if assert.NoError(t, r.Err, te.Expect()) {
+
+			assert.Equal(t, http.StatusOK, r.Code, te.Expect())
+			assert.True(t, r.Response.Success, te.Expect())
+		}
+	}
+	assertError(t, te.Request([]byte(`{"email":"one_too_many@website.com"}`)), http.StatusTooManyRequests, "Too Many Requests")
+
+	// nothing changes until a link is used
+	if serr := u.GetUser(authentication.SERVER); assert.NoError(t, serr.Err) {
+		assert.Equal(t, "email@website.com", *u.Email)
+	}
+}
+
+func TestEmailChangeByOthers(t *testing.T) {
+	u := prepareTestUser(t)
+	app := prepareTestApplication(t)
+	clientToken, err := app.CreateToken(authentication.UsersScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the user can move their account to another address
+	te.Authorize(clientToken)
+	te.Target("PUT", fmt.Sprintf("/user/%d", u.ID))
+	assertError(t, te.Request([]byte(`{"email":"new@website.com"}`)), http.StatusForbidden, "Cannot Change Email")
+
+	if serr := u.GetUser(authentication.SERVER); assert.NoError(t, serr.Err) {
+		assert.Equal(t, "email@website.com", *u.Email)
+	}
+	sent, serr := database.CountMagicLinks(u.ID, "new@website.com", database.MagicEmail, time.Now().Add(-time.Hour))
+	if assert.NoError(t, serr.Err) {
+		assert.Equal(t, 0, sent)
+	}
+}
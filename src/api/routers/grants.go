@@ -0,0 +1,61 @@
+package routers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/gorilla/mux"
+)
+
+// list the applications the user has given consent to
+func getGrants(w http.ResponseWriter, r *http.Request) {
+	u, response := sessionOwner(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	grants, serr := database.GetGrants(u.ID)
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	res.New(http.StatusOK).SetGrants(grants).JSON(w)
+}
+
+// take back consent from an application, signing the user out of it
+func revokeGrant(w http.ResponseWriter, r *http.Request) {
+	u, response := sessionOwner(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	aid, err := strconv.Atoi(vars["aid"])
+	if err != nil {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Application ID").Error(w)
+		return
+	}
+
+	grant := database.Grant{UserID: u.ID, AppID: int64(aid)}
+	if serr := grant.GetGrant(); serr.Err == sql.ErrNoRows {
+		res.New(http.StatusNotFound).SetErrorMessage("Grant Not Found").Error(w)
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	if serr := grant.RevokeGrant(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditApplication, Target: &u.ID, Detail: "revoked consent for application " + strconv.FormatInt(grant.AppID, 10)})
+
+	res.New(http.StatusAccepted).JSON(w)
+}
@@ -0,0 +1,337 @@
+package routers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/gorilla/mux"
+)
+
+// looks up the group from the id in the url
+func groupFromRequest(r *http.Request) (database.Group, *res.Response) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return database.Group{}, res.New(http.StatusBadRequest).SetErrorMessage("Invalid Group ID")
+	}
+
+	g := database.Group{ID: int64(id)}
+	if serr := g.GetGroup(); serr.Err == sql.ErrNoRows {
+		return g, res.New(http.StatusNotFound).SetErrorMessage("Group Not Found")
+	} else if serr.Err != nil {
+		return g, res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	return g, nil
+}
+
+// tokens carry the scopes their user had when they were issued, so once a user's
+// scopes change their tokens have to go. their sessions stay, refreshing picks up the new scopes
+func revokeMemberTokens(userIDs ...int64) *res.Response {
+	for _, id := range userIDs {
+		if err := authentication.RevokeUser(id); err != nil {
+			return res.New(http.StatusInternalServerError).SetInternalError(&res.ServerError{Err: err})
+		}
+	}
+	return nil
+}
+
+// same as revokeMemberTokens, for everybody in the group
+func revokeGroupTokens(g database.Group) *res.Response {
+	members, serr := g.GetMembers()
+	if serr.Err != nil {
+		return res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	return revokeMemberTokens(members...)
+}
+
+// register a group
+func createGroup(w http.ResponseWriter, r *http.Request) {
+	var g database.Group
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&g); err != nil || g.Name == nil || g.Description == nil {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	if *g.Name == "" {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Group Name").Error(w)
+		return
+	}
+
+	check := database.Group{Name: g.Name}
+	if serr := check.GetGroupByName(); serr.Err == nil {
+		res.New(http.StatusConflict).SetErrorMessage("Group Already Exists").Error(w)
+		return
+	} else if serr.Err != sql.ErrNoRows {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	g.Scopes = nil // scopes are attached through their own route
+	if serr := g.CreateGroup(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditGroup, Detail: "created " + *g.Name})
+
+	res.New(http.StatusCreated).SetGroup(g).JSON(w)
+}
+
+// get multiple
+func getGroups(w http.ResponseWriter, r *http.Request) {
+	count, _ := strconv.Atoi(r.FormValue("count"))
+	start, _ := strconv.Atoi(r.FormValue("start"))
+
+	if count > 50 {
+		count = 50
+	} else if count < 0 {
+		count = 0
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	groups, serr := database.GetGroups(start, count)
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	res.New(http.StatusOK).SetGroups(groups).JSON(w)
+}
+
+// get
+func getGroup(w http.ResponseWriter, r *http.Request) {
+	g, response := groupFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if serr := g.GetScopes(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	res.New(http.StatusOK).SetGroup(g).JSON(w)
+}
+
+// update
+func updateGroup(w http.ResponseWriter, r *http.Request) {
+	g, response := groupFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	var update database.Group
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&update); err != nil {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	update.ID = g.ID
+	if update.Name != nil && *update.Name == "" {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Group Name").Error(w)
+		return
+	}
+	if update.Name != nil && *update.Name != *g.Name {
+		check := database.Group{Name: update.Name}
+		if serr := check.GetGroupByName(); serr.Err == nil {
+			res.New(http.StatusConflict).SetErrorMessage("Group Already Exists").Error(w)
+			return
+		} else if serr.Err != sql.ErrNoRows {
+			res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+			return
+		}
+	}
+
+	if serr := update.UpdateGroup(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	if serr := g.GetGroup(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditGroup, Detail: "updated " + *g.Name})
+	if serr := g.GetScopes(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	res.New(http.StatusOK).SetGroup(g).JSON(w)
+}
+
+// delete
+func deleteGroup(w http.ResponseWriter, r *http.Request) {
+	g, response := groupFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	// find out who's losing scopes before the memberships are gone
+	members, serr := g.GetMembers()
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	if serr := g.DeleteGroup(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if response := revokeMemberTokens(members...); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditGroup, Detail: "deleted " + *g.Name})
+
+	res.New(http.StatusAccepted).JSON(w)
+}
+
+// looks up the group and the scope from the ids in the url
+func groupScopeFromRequest(r *http.Request) (database.Group, database.Scope, *res.Response) {
+	g, response := groupFromRequest(r)
+	if response != nil {
+		return g, database.Scope{}, response
+	}
+
+	vars := mux.Vars(r)
+	sid, err := strconv.Atoi(vars["sid"])
+	if err != nil {
+		return g, database.Scope{}, res.New(http.StatusBadRequest).SetErrorMessage("Invalid Scope ID")
+	}
+
+	s := database.Scope{ID: int64(sid)}
+	if serr := s.GetScope(); serr.Err == sql.ErrNoRows {
+		return g, s, res.New(http.StatusNotFound).SetErrorMessage("Scope Not Found")
+	} else if serr.Err != nil {
+		return g, s, res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	return g, s, nil
+}
+
+// give the group's members a scope
+func attachGroupScope(w http.ResponseWriter, r *http.Request) {
+	g, s, response := groupScopeFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if serr := g.AddScope(s.ID); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if response := revokeGroupTokens(g); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditGroup, Detail: "gave " + *g.Name + " " + *s.Name})
+
+	if serr := g.GetScopes(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	res.New(http.StatusOK).SetGroup(g).JSON(w)
+}
+
+// take a scope away from the group's members
+func detachGroupScope(w http.ResponseWriter, r *http.Request) {
+	g, s, response := groupScopeFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if serr := g.RemoveScope(s.ID); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if response := revokeGroupTokens(g); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditGroup, Detail: "took " + *s.Name + " from " + *g.Name})
+
+	if serr := g.GetScopes(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	res.New(http.StatusOK).SetGroup(g).JSON(w)
+}
+
+// looks up the group and the user from the ids in the url
+func groupMemberFromRequest(r *http.Request) (database.Group, database.User, *res.Response) {
+	g, response := groupFromRequest(r)
+	if response != nil {
+		return g, database.User{}, response
+	}
+
+	vars := mux.Vars(r)
+	uid, err := strconv.Atoi(vars["uid"])
+	if err != nil {
+		return g, database.User{}, res.New(http.StatusBadRequest).SetErrorMessage("Invalid User ID")
+	}
+
+	u := database.User{ID: int64(uid)}
+	if serr := u.GetUser(authentication.USER); serr.Err == sql.ErrNoRows {
+		return g, u, res.New(http.StatusNotFound).SetErrorMessage("User Not Found")
+	} else if serr.Err != nil {
+		return g, u, res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	return g, u, nil
+}
+
+// put a user in the group
+func addGroupMember(w http.ResponseWriter, r *http.Request) {
+	g, u, response := groupMemberFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if serr := g.AddMember(u.ID); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if response := revokeMemberTokens(u.ID); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditGroup, Target: &u.ID, Detail: "added to " + *g.Name})
+
+	res.New(http.StatusAccepted).JSON(w)
+}
+
+// take a user out of the group
+func removeGroupMember(w http.ResponseWriter, r *http.Request) {
+	g, u, response := groupMemberFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if serr := g.RemoveMember(u.ID); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if response := revokeMemberTokens(u.ID); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditGroup, Target: &u.ID, Detail: "removed from " + *g.Name})
+
+	res.New(http.StatusAccepted).JSON(w)
+}
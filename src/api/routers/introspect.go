@@ -0,0 +1,102 @@
+package routers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+)
+
+// IntrospectionResponse is what /oauth/introspect says about a token, as laid out by RFC 7662
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Expires   int64  `json:"exp,omitempty"`
+	Subject   string `json:"sub,omitempty"` // the user's uuid, or the client id for client tokens
+	Audience  string `json:"aud,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	ID        string `json:"jti,omitempty"`
+	Session   int64  `json:"sid,omitempty"`
+}
+
+// introspectToken lets applications ask if a token is still good and who it belongs to
+func introspectToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "Invalid Request Payload")
+		return
+	}
+
+	app, oerr := authenticateClient(r)
+	if oerr != nil && oerr.Error == "server_error" {
+		writeOAuth(w, http.StatusInternalServerError, oerr)
+		return
+	} else if oerr == nil && app.IsPublic() { // anybody could claim to be a public client
+		oerr = &OAuthError{Error: "invalid_client", Description: "Public Clients Can't Introspect"}
+	}
+	if oerr != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		writeOAuth(w, http.StatusUnauthorized, oerr)
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "Missing Token")
+		return
+	}
+
+	// the spec doesn't want the caller to learn why a token is no good, only that it isn't
+	inactive := IntrospectionResponse{Active: false}
+	claims, err := authentication.ParseToken(token)
+	switch err {
+	case nil:
+	case authentication.ErrTokenUnreadable, authentication.ErrTokenInvalid, authentication.ErrSessionRevoked, authentication.ErrTokenRevoked:
+		writeOAuth(w, http.StatusOK, inactive)
+		return
+	default:
+		res.New(http.StatusInternalServerError).SetInternalError(&res.ServerError{Err: err}).Error(w)
+		return
+	}
+
+	response := IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.Audience,
+		TokenType: "Bearer",
+		Expires:   claims.ExpiresAt,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		ID:        claims.Id,
+		Session:   claims.Session,
+	}
+
+	if claims.Client != "" { // the application acting as itself
+		response.ClientID = claims.Client
+		writeOAuth(w, http.StatusOK, response)
+		return
+	}
+
+	// the token's claims are from when it was issued, the account could have gone since
+	u := database.User{ID: claims.ID}
+	if serr := u.GetUser(authentication.USER); serr.Err == sql.ErrNoRows {
+		writeOAuth(w, http.StatusOK, inactive)
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if u.Banned != nil && *u.Banned {
+		writeOAuth(w, http.StatusOK, inactive)
+		return
+	}
+
+	response.Subject = *u.UUID
+	response.Username = *u.Name
+	writeOAuth(w, http.StatusOK, response)
+}
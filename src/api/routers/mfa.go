@@ -0,0 +1,307 @@
+package routers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+)
+
+// how long a user has to give their code after getting the password right
+const mfaChallengeLifetime = time.Minute * 5
+
+// MFARequest is the request expected on /login/mfa, with a code, a recovery code or a credential
+// from a security key
+type MFARequest struct {
+	Challenge    string                              `json:"challenge"`
+	Code         string                              `json:"code"`
+	RecoveryCode string                              `json:"recovery_code"`
+	Credential   *authentication.PublicKeyCredential `json:"credential"`
+}
+
+// TOTPEnrollment is what an authenticator app needs to be set up
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// confirms the token's user is the user in the url, admins can't set up someone else's second factor
+func selfOwner(r *http.Request) (database.User, *res.Response) {
+	u, response := sessionOwner(r)
+	if response != nil {
+		return u, response
+	}
+
+	ctx := r.Context().Value(authentication.CLAIMS).(authentication.Context)
+	if ctx.Claims.ID != u.ID {
+		return u, res.New(http.StatusForbidden).SetErrorMessage("Invalid Permissions")
+	}
+	return u, nil
+}
+
+// checks a code from the user's authenticator or a login with their security key, or burns one of
+// their recovery codes
+func checkSecondFactor(userID int64, mr MFARequest) *res.Response {
+	if mr.Credential != nil {
+		stored, response := checkAssertion(*mr.Credential, webAuthnPurposeMFA, false)
+		if response != nil {
+			return response
+		}
+		if stored.UserID != userID {
+			return res.New(http.StatusUnauthorized).SetErrorMessage("Unknown Credential")
+		}
+		return nil
+	}
+
+	if mr.RecoveryCode != "" {
+		if serr := database.UseRecoveryCode(userID, mr.RecoveryCode); serr.Err == sql.ErrNoRows {
+			return res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Code")
+		} else if serr.Err != nil {
+			return res.New(http.StatusInternalServerError).SetInternalError(&serr)
+		}
+		return nil
+	}
+
+	t := database.TOTP{UserID: userID}
+	if serr := t.GetTOTP(); serr.Err == sql.ErrNoRows {
+		return res.New(http.StatusNotFound).SetErrorMessage("Two Factor Not Enrolled")
+	} else if serr.Err != nil {
+		return res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+
+	step, ok := authentication.VerifyTOTP(t.Secret, mr.Code, time.Now(), t.LastStep)
+	if !ok {
+		return res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Code")
+	}
+	// somebody beat them to it with the same code
+	if serr := t.UseTOTPStep(step); serr.Err == sql.ErrNoRows {
+		return res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Code")
+	} else if serr.Err != nil {
+		return res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	return nil
+}
+
+// second step of logging in for users with two factor on
+func validateMFA(w http.ResponseWriter, r *http.Request) {
+	var mr MFARequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&mr); err != nil || mr.Challenge == "" || (mr.Code == "" && mr.RecoveryCode == "" && mr.Credential == nil) {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	c := database.MFAChallenge{Challenge: mr.Challenge}
+	if serr := c.GetMFAChallenge(); serr.Err == sql.ErrNoRows {
+		res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Challenge").Error(w)
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	if response := checkSecondFactor(c.UserID, mr); response != nil {
+		if response.Code == http.StatusUnauthorized { // only so many guesses per password
+			if serr := c.FailMFAChallenge(); serr.Err != nil {
+				res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+				return
+			}
+			audit(r, database.AuditEvent{Type: database.AuditLoginFailed, Target: &c.UserID, Detail: "wrong second factor"})
+		}
+		response.Error(w)
+		return
+	}
+
+	if serr := c.DeleteMFAChallenge(); serr.Err == sql.ErrNoRows {
+		res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Challenge").Error(w)
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	u := database.User{ID: c.UserID}
+	if serr := u.GetUser(authentication.SERVER); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	// they could have been banned since they got the password right
+	if response := checkBan(r, &u); response != nil {
+		response.Error(w)
+		return
+	}
+
+	completeLogin(w, r, u)
+}
+
+// start setting up an authenticator, two factor isn't on until a code from it is confirmed
+func enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	u, response := selfOwner(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if enabled, serr := database.TOTPEnabled(u.ID); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	} else if enabled {
+		res.New(http.StatusConflict).SetErrorMessage("Two Factor Already Enabled").Error(w)
+		return
+	}
+
+	if serr := u.GetUser(authentication.USER); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	secret, err := authentication.GenerateTOTPSecret()
+	if err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&res.ServerError{Err: err}).Error(w)
+		return
+	}
+
+	t := database.TOTP{UserID: u.ID, Secret: secret}
+	if serr := t.SaveTOTP(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	enrollment := TOTPEnrollment{Secret: secret, URI: authentication.TOTPURI(settings.Host, *u.Name, secret)}
+	res.New(http.StatusCreated).SetTOTP(enrollment).JSON(w)
+}
+
+// turn two factor on with a code from the new authenticator, handing out the recovery codes
+func confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	u, response := selfOwner(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	var mr MFARequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&mr); err != nil || mr.Code == "" {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	t := database.TOTP{UserID: u.ID}
+	if serr := t.GetTOTP(); serr.Err == sql.ErrNoRows {
+		res.New(http.StatusNotFound).SetErrorMessage("Two Factor Not Enrolled").Error(w)
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if t.Confirmed {
+		res.New(http.StatusConflict).SetErrorMessage("Two Factor Already Enabled").Error(w)
+		return
+	}
+
+	step, ok := authentication.VerifyTOTP(t.Secret, mr.Code, time.Now(), t.LastStep)
+	if !ok {
+		res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Code").Error(w)
+		return
+	}
+	if serr := t.ConfirmTOTP(step); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	codes, serr := database.CreateRecoveryCodes(u.ID)
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditTwoFactor, Target: &u.ID, Detail: "enabled authenticator"})
+
+	res.New(http.StatusOK).SetRecoveryCodes(codes).JSON(w)
+}
+
+// swap the recovery codes for new ones, the old ones stop working
+func regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	u, response := selfOwner(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	var mr MFARequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&mr); err != nil || mr.Code == "" {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	if enabled, serr := database.TOTPEnabled(u.ID); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	} else if !enabled {
+		res.New(http.StatusNotFound).SetErrorMessage("Two Factor Not Enrolled").Error(w)
+		return
+	}
+	if response := checkSecondFactor(u.ID, MFARequest{Code: mr.Code}); response != nil {
+		response.Error(w)
+		return
+	}
+
+	codes, serr := database.CreateRecoveryCodes(u.ID)
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditTwoFactor, Target: &u.ID, Detail: "regenerated recovery codes"})
+
+	res.New(http.StatusOK).SetRecoveryCodes(codes).JSON(w)
+}
+
+// turn two factor off, users prove it's them with a code, admins can do it for users who lost theirs
+func disableTOTP(w http.ResponseWriter, r *http.Request) {
+	u, response := sessionOwner(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	t := database.TOTP{UserID: u.ID}
+	if serr := t.GetTOTP(); serr.Err == sql.ErrNoRows {
+		res.New(http.StatusNotFound).SetErrorMessage("Two Factor Not Enrolled").Error(w)
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	ctx := r.Context().Value(authentication.CLAIMS).(authentication.Context)
+	if ctx.Claims.ID == u.ID && t.Confirmed {
+		var mr MFARequest
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&mr); err != nil || (mr.Code == "" && mr.RecoveryCode == "") {
+			res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+			return
+		}
+		defer r.Body.Close()
+
+		if response := checkSecondFactor(u.ID, MFARequest{Code: mr.Code, RecoveryCode: mr.RecoveryCode}); response != nil {
+			response.Error(w)
+			return
+		}
+	}
+
+	if serr := t.DeleteTOTP(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditTwoFactor, Target: &u.ID, Detail: "disabled authenticator"})
+
+	res.New(http.StatusAccepted).JSON(w)
+}
@@ -0,0 +1,572 @@
+package routers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/log"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
+)
+
+// how long a client has to exchange an authorization code
+const authCodeLifetime = time.Minute * 10
+
+// scopes anybody can hand to an application, they only describe who the user is
+var identityScopes = []string{"openid", "profile", "email"}
+
+// scopes nobody can hand to an application, an admin approving one doesn't make it an admin.
+// applications are only given these directly, for acting as themselves
+var serviceScopes = []string{authentication.PassportScope, authentication.UsersScope}
+
+// AuthorizeRequest is the request expected on /oauth/authorize
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// TokenResponse is the response /oauth/token gives back, as laid out by RFC 6749
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// OAuthError is the error body /oauth/token gives back, as laid out by RFC 6749
+type OAuthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// the oauth endpoints don't use our response envelope, the spec decides what these look like
+func writeOAuth(w http.ResponseWriter, code int, payload interface{}) {
+	p, _ := json.Marshal(payload)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(code)
+	w.Write(p)
+}
+
+func oauthError(w http.ResponseWriter, code int, err, description string) {
+	writeOAuth(w, code, OAuthError{Error: err, Description: description})
+}
+
+// adds params onto the query of uri, keeping whatever the client already put there
+func buildRedirect(uri string, params url.Values) string {
+	u, err := url.Parse(uri)
+	if err != nil { // we only ever call this with redirect uris we validated
+		return uri
+	}
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// validates an authorization request, anything that fails before the redirect uri is
+// trusted gets a response, anything after gets an oauth error redirect
+func parseAuthorizeRequest(r *http.Request) (AuthorizeRequest, database.Application, *res.Response, url.Values) {
+	ar := AuthorizeRequest{
+		ResponseType:        r.FormValue("response_type"),
+		ClientID:            r.FormValue("client_id"),
+		RedirectURI:         r.FormValue("redirect_uri"),
+		Scope:               r.FormValue("scope"),
+		State:               r.FormValue("state"),
+		CodeChallenge:       r.FormValue("code_challenge"),
+		CodeChallengeMethod: r.FormValue("code_challenge_method"),
+		Nonce:               r.FormValue("nonce"),
+	}
+
+	app := database.Application{StrID: &ar.ClientID}
+	if ar.ClientID == "" {
+		return ar, app, res.New(http.StatusBadRequest).SetErrorMessage("Missing Client ID"), nil
+	}
+	if serr := app.GetApplicationByStrID(); serr.Err == sql.ErrNoRows {
+		return ar, app, res.New(http.StatusBadRequest).SetErrorMessage("Unknown Client"), nil
+	} else if serr.Err != nil {
+		return ar, app, res.New(http.StatusInternalServerError).SetInternalError(&serr), nil
+	}
+
+	if ar.RedirectURI == "" && app.RedirectURI != nil { // only one uri can be registered so it's implied
+		ar.RedirectURI = *app.RedirectURI
+	}
+	if !app.CheckRedirectURI(ar.RedirectURI) {
+		return ar, app, res.New(http.StatusBadRequest).SetErrorMessage("Invalid Redirect URI"), nil
+	}
+
+	// redirect uri is trusted from here on out, errors go back to the client
+	fail := url.Values{}
+	if ar.State != "" {
+		fail.Set("state", ar.State)
+	}
+
+	if ar.ResponseType != "code" {
+		fail.Set("error", "unsupported_response_type")
+		return ar, app, nil, fail
+	}
+
+	if ar.CodeChallenge == "" {
+		if app.IsPublic() { // public clients can't prove who they are without PKCE
+			fail.Set("error", "invalid_request")
+			fail.Set("error_description", "PKCE Required")
+			return ar, app, nil, fail
+		}
+	} else if ar.CodeChallengeMethod != "S256" { // plain would hand the verifier to anybody watching
+		fail.Set("error", "invalid_request")
+		fail.Set("error_description", "Unsupported Code Challenge Method")
+		return ar, app, nil, fail
+	}
+
+	// applications can only ask for scopes that exist
+	requested := strings.Fields(authentication.UnionScopes(ar.Scope, ""))
+	scopes, serr := database.GetScopesByName(requested)
+	if serr.Err != nil {
+		return ar, app, res.New(http.StatusInternalServerError).SetInternalError(&serr), nil
+	}
+	if len(scopes) != len(requested) {
+		fail.Set("error", "invalid_scope")
+		return ar, app, nil, fail
+	}
+	ar.Scope = strings.Join(requested, " ")
+
+	return ar, app, nil, nil
+}
+
+// narrows the requested scopes down to the ones the user is able to grant, anything besides
+// who they are has to be a scope they hold themselves, and can't be one of the service's own
+func grantableScopes(userID int64, requested string) (string, res.ServerError) {
+	held, serr := database.GetUserScopes(userID)
+	if serr.Err != nil {
+		return "", serr
+	}
+	allowed := append([]string{}, identityScopes...)
+	for _, scope := range held {
+		if !authentication.HasScope(strings.Join(serviceScopes, " "), scope) {
+			allowed = append(allowed, scope)
+		}
+	}
+	return authentication.IntersectScopes(requested, strings.Join(allowed, " ")), serr
+}
+
+// checks a PKCE code verifier against the challenge stored with the code (RFC 7636)
+func checkCodeVerifier(verifier, challenge, method string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	if method != "S256" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	verifier = base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(verifier), []byte(challenge)) == 1
+}
+
+// authorizeApplication validates the client and hands the user off to the web interface to sign in
+func authorizeApplication(w http.ResponseWriter, r *http.Request) {
+	ar, _, response, fail := parseAuthorizeRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+	if fail != nil {
+		http.Redirect(w, r, buildRedirect(ar.RedirectURI, fail), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, strings.TrimRight(settings.WebUI, "/")+"/authorize?"+r.URL.RawQuery, http.StatusFound)
+}
+
+// grantAuthorization is called by the web interface once the user has signed in. if the user
+// hasn't consented to the scopes yet the application and scopes are sent back for the consent
+// page, which calls again with consent set to approve or deny. otherwise it creates the
+// authorization code and tells the web interface where to send the user back to
+func grantAuthorization(w http.ResponseWriter, r *http.Request) {
+	ar, app, response, fail := parseAuthorizeRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+	if fail != nil {
+		res.New(http.StatusOK).SetRedirect(buildRedirect(ar.RedirectURI, fail)).JSON(w)
+		return
+	}
+
+	// only the user can hand out their scopes, not an application holding one of their tokens
+	ctx := r.Context().Value(authentication.CLAIMS).(authentication.Context)
+	if ctx.Claims.ID == 0 || ctx.Claims.Audience != "" {
+		res.New(http.StatusUnauthorized).SetErrorMessage("Login Required").Error(w)
+		return
+	}
+
+	u := database.User{ID: ctx.Claims.ID}
+	if serr := u.GetUser(authentication.SERVER); serr.Err == sql.ErrNoRows {
+		res.New(http.StatusUnauthorized).SetErrorMessage("Token's User Doesn't Exist").Error(w)
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if u.Banned != nil && *u.Banned {
+		res.New(http.StatusForbidden).SetErrorMessage("Account Banned").Error(w)
+		return
+	}
+
+	scope, serr := grantableScopes(u.ID, ar.Scope)
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	grant := database.Grant{UserID: u.ID, AppID: app.ID}
+	if serr := grant.GetGrant(); serr.Err != nil && serr.Err != sql.ErrNoRows {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	switch r.FormValue("consent") {
+	case "":
+		if grant.ID != 0 && authentication.IntersectScopes(scope, grant.Scope) == scope {
+			break // they already agreed to all of it
+		}
+
+		scopes, serr := database.GetScopesByName(strings.Fields(scope))
+		if serr.Err != nil {
+			res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+			return
+		}
+		app.CleanDataRead()
+		res.New(http.StatusOK).SetApplication(app).SetScopes(&database.ScopeList{Scopes: scopes, TotalItems: len(scopes)}).JSON(w)
+		return
+	case "approve":
+		grant.Scope = authentication.UnionScopes(grant.Scope, scope)
+		if serr := grant.SaveGrant(); serr.Err != nil {
+			res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+			return
+		}
+		audit(r, database.AuditEvent{Type: database.AuditApplication, Target: &u.ID, Detail: "consented to " + *app.StrID + " with " + grant.Scope})
+	case "deny":
+		params := url.Values{}
+		params.Set("error", "access_denied")
+		if ar.State != "" {
+			params.Set("state", ar.State)
+		}
+		res.New(http.StatusOK).SetRedirect(buildRedirect(ar.RedirectURI, params)).JSON(w)
+		return
+	default:
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Consent").Error(w)
+		return
+	}
+
+	code, err := util.CreateSecureString(48)
+	if err != nil {
+		res.New(http.StatusInternalServerError).SetErrorMessage("Failed Creating Authorization Code").Error(w)
+		return
+	}
+
+	ac := database.AuthCode{
+		Code:        code,
+		AppID:       app.ID,
+		UserID:      u.ID,
+		RedirectURI: r.FormValue("redirect_uri"), // not the implied one, it decides what /token expects
+		Expires:     time.Now().Add(authCodeLifetime),
+	}
+	if scope != "" { // only what they were able to grant
+		ac.Scope = &scope
+	}
+	if ar.CodeChallenge != "" {
+		ac.Challenge = &ar.CodeChallenge
+		ac.ChallengeMethod = &ar.CodeChallengeMethod
+	}
+	if ar.Nonce != "" {
+		ac.Nonce = &ar.Nonce
+	}
+	if serr := ac.CreateAuthCode(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	params := url.Values{}
+	params.Set("code", code)
+	if ar.State != "" {
+		params.Set("state", ar.State)
+	}
+
+	res.New(http.StatusOK).SetRedirect(buildRedirect(ar.RedirectURI, params)).JSON(w)
+}
+
+// authenticates the client calling the token endpoint, either through basic auth or the form body
+func authenticateClient(r *http.Request) (*database.Application, *OAuthError) {
+	clientID, secret, basic := r.BasicAuth()
+	if !basic {
+		clientID = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+	if clientID == "" {
+		return nil, &OAuthError{Error: "invalid_client", Description: "Missing Client ID"}
+	}
+
+	app := database.Application{StrID: &clientID}
+	if serr := app.GetApplicationByStrID(); serr.Err == sql.ErrNoRows {
+		return nil, &OAuthError{Error: "invalid_client", Description: "Unknown Client"}
+	} else if serr.Err != nil {
+		log.Error("Could not look up client, %v", serr.Err)
+		return nil, &OAuthError{Error: "server_error"}
+	}
+
+	if !app.IsPublic() && !app.CheckSecret(secret) {
+		return nil, &OAuthError{Error: "invalid_client", Description: "Invalid Client Credentials"}
+	}
+
+	return &app, nil
+}
+
+// issueToken is the oauth token endpoint
+func issueToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "Invalid Request Payload")
+		return
+	}
+
+	app, oerr := authenticateClient(r)
+	if oerr != nil && oerr.Error == "server_error" {
+		writeOAuth(w, http.StatusInternalServerError, oerr)
+		return
+	} else if oerr != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		writeOAuth(w, http.StatusUnauthorized, oerr)
+		return
+	}
+
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		exchangeAuthCode(w, r, app)
+	case "refresh_token":
+		exchangeRefreshToken(w, r, app)
+	case "client_credentials":
+		issueClientToken(w, r, app)
+	case "":
+		oauthError(w, http.StatusBadRequest, "invalid_request", "Missing Grant Type")
+	default:
+		oauthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+// trades an authorization code for a token
+func exchangeAuthCode(w http.ResponseWriter, r *http.Request, app *database.Application) {
+	ac := database.AuthCode{Code: r.PostFormValue("code")}
+	if ac.Code == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "Missing Code")
+		return
+	}
+
+	if serr := ac.ConsumeAuthCode(); serr.Err == sql.ErrNoRows {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "Invalid Code")
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	// the code has been burnt at this point, so any mismatch means the client has to start over.
+	// a redirect uri sent to /authorize has to be sent again (RFC 6749 4.1.3)
+	uri := r.PostFormValue("redirect_uri")
+	if ac.AppID != app.ID || (uri != ac.RedirectURI && (ac.RedirectURI != "" || !app.CheckRedirectURI(uri))) {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "Invalid Code")
+		return
+	}
+	if ac.Challenge != nil && !checkCodeVerifier(r.PostFormValue("code_verifier"), *ac.Challenge, *ac.ChallengeMethod) {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "Invalid Code Verifier")
+		return
+	}
+
+	u := database.User{ID: ac.UserID}
+	if serr := u.GetUser(authentication.USER); serr.Err == sql.ErrNoRows { // deleted users can't finish
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "User Doesn't Exist")
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if u.Banned != nil && *u.Banned {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "Account Banned")
+		return
+	}
+
+	var scope string
+	if ac.Scope != nil {
+		scope = *ac.Scope
+	}
+
+	login := database.Login{UserID: u.ID, UserUUID: *u.UUID, IP: requestIP(r), UserAgent: userAgent(r), AppID: &app.ID, Scope: ac.Scope}
+	if serr := login.CreateLogin(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	token, err := u.CreateToken(database.TokenOptions{Audience: *app.StrID, Scope: scope, Session: login.ID})
+	if err != nil {
+		res.New(http.StatusInternalServerError).SetErrorMessage("Failed Creating Token").Error(w)
+		return
+	}
+
+	// update login information
+	u.LastToken = &token
+	u.LastLogin = &[]time.Time{time.Now()}[0]
+	u.LastIP = &[]string{requestIP(r).String()}[0]
+	if serr := u.UpdateUser(authentication.SERVER); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditLogin, Actor: &u.ID, Client: app.StrID, Target: &u.ID})
+
+	tr := TokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(database.TokenLifetime / time.Second),
+		RefreshToken: login.Token,
+		Scope:        scope,
+	}
+
+	if authentication.HasScope(scope, "openid") {
+		var nonce string
+		if ac.Nonce != nil {
+			nonce = *ac.Nonce
+		}
+		if tr.IDToken, err = u.CreateIDToken(*app.StrID, nonce, scope); err != nil {
+			res.New(http.StatusInternalServerError).SetErrorMessage("Failed Creating ID Token").Error(w)
+			return
+		}
+	}
+
+	writeOAuth(w, http.StatusOK, tr)
+}
+
+// trades a refresh token from an earlier exchange for a new token, rotating the refresh token
+func exchangeRefreshToken(w http.ResponseWriter, r *http.Request, app *database.Application) {
+	login := database.Login{Token: r.PostFormValue("refresh_token"), AppID: &app.ID}
+	if login.Token == "" {
+		oauthError(w, http.StatusBadRequest, "invalid_request", "Missing Refresh Token")
+		return
+	}
+
+	if serr := login.RotateLogin(); serr.Err == sql.ErrNoRows {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "Invalid Refresh Token")
+		return
+	} else if serr.Err == database.ErrRefreshTokenReused {
+		audit(r, database.AuditEvent{Type: database.AuditRefresh, Client: app.StrID, Target: &login.UserID, Detail: "refresh token reused, session revoked"})
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "Refresh Token Reused")
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	u := database.User{ID: login.UserID}
+	if serr := u.GetUser(authentication.USER); serr.Err == sql.ErrNoRows {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "User Doesn't Exist")
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if u.Banned != nil && *u.Banned {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "Account Banned")
+		return
+	}
+
+	grant := database.Grant{UserID: u.ID, AppID: app.ID}
+	if serr := grant.GetGrant(); serr.Err == sql.ErrNoRows {
+		oauthError(w, http.StatusBadRequest, "invalid_grant", "Consent Revoked")
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	// scopes may have been taken away from the user since they signed in
+	var scope string
+	if login.Scope != nil {
+		scope = authentication.IntersectScopes(*login.Scope, grant.Scope)
+	}
+	scope, serr := grantableScopes(u.ID, scope)
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	token, err := u.CreateToken(database.TokenOptions{Audience: *app.StrID, Scope: scope, Session: login.ID})
+	if err != nil {
+		res.New(http.StatusInternalServerError).SetErrorMessage("Failed Creating Token").Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditRefresh, Actor: &u.ID, Client: app.StrID, Target: &u.ID})
+
+	writeOAuth(w, http.StatusOK, TokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(database.TokenLifetime / time.Second),
+		RefreshToken: login.Token,
+		Scope:        scope,
+	})
+}
+
+// issues a token to a confidential application acting as itself, carrying the scopes assigned to it
+func issueClientToken(w http.ResponseWriter, r *http.Request, app *database.Application) {
+	if app.IsPublic() { // anybody could be holding a public client id
+		oauthError(w, http.StatusBadRequest, "unauthorized_client", "Public Clients Can't Use Client Credentials")
+		return
+	}
+
+	if serr := app.GetScopes(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	scope := strings.Join(app.Scopes, " ")
+
+	// they can ask for less than what they were assigned, never more
+	if requested := r.PostFormValue("scope"); requested != "" {
+		requested = authentication.UnionScopes(requested, "")
+		if authentication.IntersectScopes(requested, scope) != requested {
+			oauthError(w, http.StatusBadRequest, "invalid_scope", "")
+			return
+		}
+		scope = requested
+	}
+
+	token, err := app.CreateToken(scope)
+	if err != nil {
+		res.New(http.StatusInternalServerError).SetErrorMessage("Failed Creating Token").Error(w)
+		return
+	}
+
+	writeOAuth(w, http.StatusOK, TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(database.TokenLifetime / time.Second),
+		Scope:       scope,
+	})
+}
@@ -0,0 +1,176 @@
+package routers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testClientID    = "test_client"
+	testRedirectURI = "https://example.com/callback"
+	testVerifier    = "a_code_verifier_that_is_long_enough_for_pkce_0123456789"
+)
+
+// registers a public application for the test user to authorize
+func prepareTestApplication(t *testing.T) database.Application {
+	app := database.Application{
+		StrID:       &[]string{testClientID}[0],
+		Name:        &[]string{"Test Client"}[0],
+		Type:        &[]string{database.APPPUBLIC}[0],
+		RedirectURI: &[]string{testRedirectURI}[0],
+	}
+	if serr := app.CreateApplication(); serr.Err != nil {
+		t.Fatal(serr.Err)
+	}
+	return app
+}
+
+// the url the web interface posts back to once the user has signed in
+func authorizeURL(params url.Values) string {
+	sum := sha256.Sum256([]byte(testVerifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {testClientID},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	for key := range params {
+		query.Set(key, params.Get(key))
+	}
+	return "/oauth/authorize?" + query.Encode()
+}
+
+// authorizes the application as the signed in user and returns the code it was handed
+func authorizeCode(t *testing.T, params url.Values) string {
+	te.Target("POST", authorizeURL(params))
+	r := te.Request(nil)
+	if !assert.NoError(t, r.Err, te.Expect()) || !assert.Equal(t, http.StatusOK, r.Code, te.Expect()) || !assert.NotNil(t, r.Response.Redirect, te.Expect()) {
+		t.FailNow()
+	}
+	redirect, err := url.Parse(*r.Response.Redirect)
+	if !assert.NoError(t, err) || !assert.NotEmpty(t, redirect.Query().Get("code"), te.Expect()) {
+		t.FailNow()
+	}
+	return redirect.Query().Get("code")
+}
+
+func TestAuthorizationCode(t *testing.T) {
+	u := prepareTestUser(t)
+	prepareTestApplication(t)
+	userToken, err := u.CreateToken(database.TokenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	appToken, err := u.CreateToken(database.TokenOptions{Audience: testClientID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// plain PKCE is turned away, back at the client
+	te.Authorize(userToken)
+	te.Target("POST", authorizeURL(url.Values{"code_challenge_method": {"plain"}}))
+	r := te.Request(nil)
+	if assert.NoError(t, r.Err, te.Expect()) && assert.NotNil(t, r.Response.Redirect, te.Expect()) {
+		redirect, _ := url.Parse(*r.Response.Redirect)
+		assert.Equal(t, "invalid_request", redirect.Query().Get("error"), te.Expect())
+		assert.Empty(t, redirect.Query().Get("code"), te.Expect())
+	}
+
+	// an application can't consent for the user with a token of theirs
+	te.Authorize(appToken)
+	te.Target("POST", authorizeURL(url.Values{"consent": {"approve"}}))
+	assertError(t, te.Request(nil), http.StatusUnauthorized, "Login Required")
+
+	// the user is asked first
+	te.Authorize(userToken)
+	te.Target("POST", authorizeURL(nil))
+	r = te.Request(nil)
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusOK, r.Code, te.Expect())
+		assert.Nil(t, r.Response.Redirect, te.Expect())
+	}
+
+	// a redirect uri sent to /authorize has to be sent again
+	code := authorizeCode(t, url.Values{"redirect_uri": {testRedirectURI}, "consent": {"approve"}})
+	te.Authorize("")
+	te.Target("POST", "/oauth/token")
+	token := url.Values{"grant_type": {"authorization_code"}, "client_id": {testClientID}, "code": {code}, "code_verifier": {testVerifier}}
+	assertError(t, te.RequestForm(token), http.StatusBadRequest, "invalid_grant")
+
+	te.Authorize(userToken)
+	code = authorizeCode(t, url.Values{"redirect_uri": {testRedirectURI}})
+	te.Authorize("")
+	te.Target("POST", "/oauth/token")
+	token.Set("code", code)
+	token.Set("redirect_uri", testRedirectURI)
+	r = te.RequestForm(token)
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusOK, r.Code, te.Expect())
+		assert.Nil(t, r.Response.Error, te.Expect())
+	}
+
+	// codes only work once
+	assertError(t, te.RequestForm(token), http.StatusBadRequest, "invalid_grant")
+
+	// it can be left out of both, the registered one is implied
+	te.Authorize(userToken)
+	code = authorizeCode(t, nil)
+	te.Authorize("")
+	te.Target("POST", "/oauth/token")
+	token.Set("code", code)
+	token.Del("redirect_uri")
+	r = te.RequestForm(token)
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusOK, r.Code, te.Expect())
+		assert.Nil(t, r.Response.Error, te.Expect())
+	}
+}
+
+func TestConsentWithholdsPassport(t *testing.T) {
+	u := prepareTestUser(t)
+	app := prepareTestApplication(t)
+	passport := database.Group{Name: &[]string{"passport"}[0]}
+	if serr := passport.GetGroupByName(); serr.Err != nil {
+		t.Fatal(serr.Err)
+	}
+	if serr := passport.AddMember(u.ID); serr.Err != nil {
+		t.Fatal(serr.Err)
+	}
+	adminToken, err := u.CreateToken(database.TokenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an admin approving an application doesn't hand it their passport
+	te.Authorize(adminToken)
+	authorizeCode(t, url.Values{"scope": {"openid passport"}, "consent": {"approve"}})
+	grant := database.Grant{UserID: u.ID, AppID: app.ID}
+	if serr := grant.GetGrant(); assert.NoError(t, serr.Err) {
+		assert.Equal(t, "openid", grant.Scope)
+	}
+
+	// and a token that somehow carries it still can't get at the admin routes
+	appToken, err := u.CreateToken(database.TokenOptions{Audience: testClientID, Scope: "openid passport"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	te.Authorize(appToken)
+	te.Target("GET", "/audit")
+	assertError(t, te.Request(nil), http.StatusForbidden, "Invalid Permissions")
+
+	te.Authorize(adminToken)
+	r := te.Request(nil)
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusOK, r.Code, te.Expect())
+	}
+}
@@ -0,0 +1,97 @@
+package routers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+)
+
+// OpenIDConfiguration is the discovery document laid out by OpenID Connect Discovery 1.0
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+// getOpenIDConfiguration lets openid connect libraries find everything on their own
+func getOpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	writeOAuth(w, http.StatusOK, OpenIDConfiguration{
+		Issuer:                            settings.Issuer,
+		AuthorizationEndpoint:             settings.Issuer + "/oauth/authorize",
+		TokenEndpoint:                     settings.Issuer + "/oauth/token",
+		UserInfoEndpoint:                  settings.Issuer + "/userinfo",
+		IntrospectionEndpoint:             settings.Issuer + "/oauth/introspect",
+		JWKSURI:                           settings.Issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{settings.Keys.Algorithm},
+		ScopesSupported:                   []string{"openid", "profile", "email"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "nonce", "preferred_username", "email", "email_verified", "locale"},
+		CodeChallengeMethodsSupported:     []string{"S256", "plain"},
+	})
+}
+
+// getUserInfo returns the openid claims of the token's user
+func getUserInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context().Value(authentication.CLAIMS).(authentication.Context) // confirmed valid on jwt layer
+
+	if ctx.Claims.ID == 0 {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauthError(w, http.StatusUnauthorized, "invalid_token", "Login Required")
+		return
+	}
+
+	// first party tokens from /login were never narrowed down, applications need openid
+	scope := ctx.Claims.Scope
+	if ctx.Claims.Audience == "" {
+		scope = "openid profile email"
+	} else if !authentication.HasScope(scope, "openid") {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		oauthError(w, http.StatusForbidden, "insufficient_scope", "Requires openid Scope")
+		return
+	}
+
+	u := database.User{ID: ctx.Claims.ID}
+	if serr := u.GetUser(authentication.USER); serr.Err == sql.ErrNoRows {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauthError(w, http.StatusUnauthorized, "invalid_token", "Token's User Doesn't Exist")
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if u.Banned != nil && *u.Banned {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauthError(w, http.StatusUnauthorized, "invalid_token", "Account Banned")
+		return
+	}
+
+	writeOAuth(w, http.StatusOK, u.OpenIDClaims(scope))
+}
+
+// getJWKS publishes the public keys tokens are signed with, so other services can verify them
+func getJWKS(w http.ResponseWriter, r *http.Request) {
+	p, _ := json.Marshal(authentication.JWKS())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=900")
+	w.WriteHeader(http.StatusOK)
+	w.Write(p)
+}
@@ -0,0 +1,156 @@
+package routers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/log"
+	"github.com/IWannaCommunity/gate-jump/src/api/mailer"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
+	smtp "github.com/go-mail/mail"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// how long a password reset link works for after it's sent
+	resetLinkLifetime = time.Hour
+	// how many reset links can go to a user or an address in resetRequestWindow
+	resetRequestLimit  = 3
+	resetRequestWindow = time.Hour
+)
+
+// ForgotPasswordRequest is the request expected on /password/forgot
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest is the request expected on /password/reset/{magic}
+type ResetPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// mails the user a link to reset their password with. it answers the same whether or not the
+// email belongs to anyone, so it can't be used to find out who has an account
+func forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var fr ForgotPasswordRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&fr); err != nil || !util.IsValidEmail(fr.Email) {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	res.New(http.StatusAccepted).JSON(w)
+
+	u := database.User{Email: &fr.Email}
+	if serr := u.GetUserByEmail(authentication.SERVER); serr.Err == sql.ErrNoRows {
+		return
+	} else if serr.Err != nil {
+		log.Error("Could not look up a user for a password reset, %v", serr.Err)
+		return
+	}
+	if u.Deleted != nil && *u.Deleted {
+		return
+	}
+
+	// counted by user and by address, so neither can be used to flood an inbox. going over is
+	// answered the same as anything else
+	sent, serr := database.CountMagicLinks(u.ID, *u.Email, database.MagicReset, time.Now().Add(-resetRequestWindow))
+	if serr.Err != nil {
+		log.Error("Could not count password reset links, %v", serr.Err)
+		return
+	}
+	if sent >= resetRequestLimit {
+		return
+	}
+
+	// only the newest link works
+	if serr := database.ExpireMagicLinks(u.ID, database.MagicReset); serr.Err != nil {
+		log.Error("Could not expire old password reset links, %v", serr.Err)
+		return
+	}
+
+	magic, err := util.CreateSecureString(32)
+	if err != nil {
+		log.Error("Could not generate a password reset link, %v", err)
+		return
+	}
+	ml := database.MagicLink{UserID: u.ID, Magic: magic, Purpose: database.MagicReset, Email: *u.Email, ExpiresAt: time.Now().Add(resetLinkLifetime)}
+	if serr := ml.CreateMagicLink(); serr.Err != nil {
+		log.Error("Could not create a password reset link, %v", serr.Err)
+		return
+	}
+
+	msg := smtp.NewMessage()
+	msg.SetHeader("From", settings.Mailer.User)
+	msg.SetHeader("To", *u.Email)
+	msg.SetHeader("Subject", "Password Reset for I Wanna Community")
+	msg.SetBody("text/plain", `Somebody asked to reset the password for `+*u.Name+`.
+If it was you, choose a new password by following the link below, it works for an hour.
+
+`+strings.TrimRight(settings.WebUI, "/")+`/reset/`+ml.Magic+`
+
+If it wasn't you, you can ignore this email and your password will stay the same.`)
+	mailer.Outbox <- msg
+}
+
+// sets a new password with a link from forgotPassword, signing the user out everywhere
+func resetPassword(w http.ResponseWriter, r *http.Request) {
+	var rr ResetPasswordRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&rr); err != nil || rr.Password == "" {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	if !util.IsValidPassword(rr.Password) {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Password Format").Error(w)
+		return
+	}
+
+	ml, ok := useMagicLink(w, r, database.MagicReset, nil)
+	if !ok {
+		return
+	}
+
+	hashpwd, err := bcrypt.GenerateFromPassword([]byte(rr.Password), 12)
+	if err != nil {
+		res.New(http.StatusInternalServerError).SetErrorMessage("Failed Encrypting Password").Error(w)
+		return
+	}
+
+	// getting the link proves they own the email, so that's verified too
+	u := database.User{ID: ml.UserID, Password: &[]string{string(hashpwd)}[0], Verified: &[]bool{true}[0]}
+	if serr := u.UpdateUser(authentication.SERVER); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	if response := revokeUser(u.ID); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditPasswordReset, Actor: &u.ID, Target: &u.ID})
+
+	if serr := u.GetUser(authentication.SERVER); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	msg := smtp.NewMessage()
+	msg.SetHeader("From", settings.Mailer.User)
+	msg.SetHeader("To", *u.Email)
+	msg.SetHeader("Subject", "Your I Wanna Community Password Was Changed")
+	msg.SetBody("text/plain", "The password for "+*u.Name+" was just reset and you've been signed out everywhere. If this wasn't you, please contact an administrator.")
+	mailer.Outbox <- msg
+
+	res.New(http.StatusAccepted).JSON(w)
+}
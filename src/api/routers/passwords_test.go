@@ -0,0 +1,33 @@
+package routers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForgotPassword(t *testing.T) {
+	u := prepareTestUser(t)
+	te.Target("POST", "/password/forgot")
+
+	assertError(t, te.Request([]byte(`{"email":"email"}`)), http.StatusBadRequest, "Invalid Request Payload")
+
+	// nobody can tell whether the address has an account, or whether it was sent anything
+	for _, body := range []string{`{"email":"nobody@website.com"}`, `{"email":"email@website.com"}`, `{"email":"email@website.com"}`, `{"email":"email@website.com"}`, `{"email":"email@website.com"}`} {
+		r := te.Request([]byte(body))
+		if assert.NoError(t, r.Err, te.Expect()) {
+
+			assert.Equal(t, http.StatusAccepted, r.Code, te.Expect())
+			assert.True(t, r.Response.Success, te.Expect())
+		}
+	}
+
+	// but only so many links went out
+	sent, serr := database.CountMagicLinks(u.ID, *u.Email, database.MagicReset, time.Now().Add(-time.Hour))
+	if assert.NoError(t, serr.Err) {
+		assert.Equal(t, resetRequestLimit, sent)
+	}
+}
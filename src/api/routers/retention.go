@@ -0,0 +1,78 @@
+package routers
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/log"
+	"github.com/IWannaCommunity/gate-jump/src/api/mailer"
+	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+	smtp "github.com/go-mail/mail"
+)
+
+const (
+	// how often deleted accounts are checked on
+	retentionSweepInterval = time.Hour
+	// how long the owner of a deleted account has between being warned and it being erased
+	purgeWarningLead = time.Hour * 24 * 7
+)
+
+// RetentionDaemon erases accounts that were deleted longer ago than the retention period, warning
+// their owners by mail first
+func RetentionDaemon() {
+	for range time.Tick(retentionSweepInterval) {
+		sweepDeletedUsers(time.Now())
+	}
+}
+
+func sweepDeletedUsers(now time.Time) {
+	// a retention shorter than the warning means they're warned as soon as they delete
+	lead := purgeWarningLead
+	if lead > settings.DeletionRetention {
+		lead = settings.DeletionRetention
+	}
+
+	warn, serr := database.GetUsersToWarn(now.Add(lead - settings.DeletionRetention))
+	if serr.Err != nil {
+		log.Error("Could not find deleted accounts to warn, %v", serr.Err)
+	}
+	for _, u := range warn {
+		if serr := u.MarkPurgeWarned(); serr.Err != nil {
+			log.Error("Could not mark a deleted account as warned, %v", serr.Err)
+			continue
+		}
+		if u.Email == nil {
+			continue
+		}
+
+		// they always get the whole lead, even if the daemon was down when they should've been warned
+		purgeAt := u.DateDeleted.Add(settings.DeletionRetention)
+		if purgeAt.Before(now.Add(lead)) {
+			purgeAt = now.Add(lead)
+		}
+		msg := smtp.NewMessage()
+		msg.SetHeader("From", settings.Mailer.User)
+		msg.SetHeader("To", *u.Email)
+		msg.SetHeader("Subject", "Your I Wanna Community Account Will Be Erased")
+		msg.SetBody("text/plain", "Your account "+*u.Name+" was deleted and will be permanently erased on "+purgeAt.UTC().Format(mailDateFormat)+". If you want to keep it, sign in before then and it will be restored.")
+		mailer.Outbox <- msg
+	}
+
+	purge, serr := database.GetUsersToPurge(now.Add(-settings.DeletionRetention), now.Add(-lead))
+	if serr.Err != nil {
+		log.Error("Could not find deleted accounts to erase, %v", serr.Err)
+	}
+	for i := range purge {
+		if serr := purge[i].PurgeUser(); serr.Err == sql.ErrNoRows {
+			continue // they signed in and restored it since
+		} else if serr.Err != nil {
+			log.Error("Could not erase a deleted account, %v", serr.Err)
+			continue
+		}
+		e := database.AuditEvent{Type: database.AuditPurge, Target: &purge[i].ID}
+		if serr := e.CreateAuditEvent(); serr.Err != nil {
+			log.Error("Could not record a %s audit event, %v", e.Type, serr.Err)
+		}
+	}
+}
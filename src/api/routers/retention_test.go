@@ -0,0 +1,56 @@
+package routers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSweepDeletedUsers(t *testing.T) {
+	u := prepareTestUser(t)
+	restored := registerTestUser(t, "other_user", "other@website.com")
+	for _, deleted := range []database.User{u, restored} {
+		if serr := deleted.DeleteUser(); serr.Err != nil {
+			t.Fatal(serr.Err)
+		}
+	}
+
+	// signing in before it's erased brings the account back
+	te.Target("POST", "/login")
+	r := te.Request([]byte(`{"username":"other_user","password":"12345678"}`))
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusOK, r.Code, te.Expect())
+		assert.NotNil(t, r.Response.Token, te.Expect())
+	}
+
+	// nothing is erased inside the retention period
+	sweepDeletedUsers(time.Now())
+	if serr := u.GetUser(authentication.SERVER); assert.NoError(t, serr.Err) {
+		assert.Nil(t, u.Purged)
+		assert.Equal(t, "test_user", *u.Name)
+	}
+
+	// long enough after for the warning to have gone out too
+	sweepDeletedUsers(time.Now().Add(settings.DeletionRetention + purgeWarningLead + time.Minute))
+	if serr := u.GetUser(authentication.SERVER); assert.NoError(t, serr.Err) {
+		assert.NotNil(t, u.Purged)
+		assert.Nil(t, u.Email)
+		assert.Equal(t, "deleted user "+strconv.FormatInt(u.ID, 10), *u.Name)
+	}
+	if serr := restored.GetUser(authentication.SERVER); assert.NoError(t, serr.Err) {
+		assert.Nil(t, restored.Purged)
+		assert.Equal(t, "other_user", *restored.Name)
+	}
+	assert.Equal(t, sql.ErrNoRows, restored.PurgeUser().Err)
+
+	// and the old password doesn't get into what's left
+	assertError(t, te.Request([]byte(`{"username":"test_user","password":"12345678"}`)), http.StatusUnauthorized, "Invalid Username or Password")
+}
@@ -1,24 +1,216 @@
 package routers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
+	"strconv"
 
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
 	"github.com/IWannaCommunity/gate-jump/src/api/database"
 	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
+	"github.com/gorilla/mux"
 )
 
+// looks up the scope from the id in the url
+func scopeFromRequest(r *http.Request) (database.Scope, *res.Response) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return database.Scope{}, res.New(http.StatusBadRequest).SetErrorMessage("Invalid Scope ID")
+	}
+
+	s := database.Scope{ID: int64(id)}
+	if serr := s.GetScope(); serr.Err == sql.ErrNoRows {
+		return s, res.New(http.StatusNotFound).SetErrorMessage("Scope Not Found")
+	} else if serr.Err != nil {
+		return s, res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	return s, nil
+}
+
+// checks nobody else already has the name, if it's being set
+func scopeNameTaken(name *string) *res.Response {
+	check := database.Scope{Name: name}
+	if serr := check.GetScopeByName(); serr.Err == nil {
+		return res.New(http.StatusConflict).SetErrorMessage("Scope Already Exists")
+	} else if serr.Err != sql.ErrNoRows {
+		return res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	return nil
+}
+
+// tokens carry scopes by name, so every user and application holding a scope that changed
+// needs new tokens. this returns the function that revokes them, so it can be looked up
+// before the scope is gone
+func scopeTokenRevoker(s database.Scope) (func() *res.Response, *res.Response) {
+	holders, serr := s.GetHolders()
+	if serr.Err != nil {
+		return nil, res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	clients, serr := s.GetClients()
+	if serr.Err != nil {
+		return nil, res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+
+	return func() *res.Response {
+		if response := revokeMemberTokens(holders...); response != nil {
+			return response
+		}
+		return revokeClientTokens(clients...)
+	}, nil
+}
+
 // register
 func createScope(w http.ResponseWriter, r *http.Request) {
 	var s database.Scope
 	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&s); err != nil {
+	if err := decoder.Decode(&s); err != nil || s.Name == nil || s.Description == nil {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	if !util.IsValidScopeName(*s.Name) {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Scope Name").Error(w)
+		return
+	}
+	if response := scopeNameTaken(s.Name); response != nil {
+		response.Error(w)
+		return
+	}
+
+	serr, scope := database.CreateScope(*s.Name, *s.Description)
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditScope, Detail: "created " + *s.Name})
+
+	res.New(http.StatusCreated).SetScope(scope).JSON(w)
+}
+
+// get multiple
+func getScopes(w http.ResponseWriter, r *http.Request) {
+	count, _ := strconv.Atoi(r.FormValue("count"))
+	start, _ := strconv.Atoi(r.FormValue("start"))
+
+	if count > 50 {
+		count = 50
+	} else if count < 0 {
+		count = 0
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	scopes, serr := database.GetScopes(start, count)
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	res.New(http.StatusOK).SetScopes(scopes).JSON(w)
+}
+
+// get
+func getScope(w http.ResponseWriter, r *http.Request) {
+	s, response := scopeFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	res.New(http.StatusOK).SetScope(s).JSON(w)
+}
+
+// update
+func updateScope(w http.ResponseWriter, r *http.Request) {
+	s, response := scopeFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	var update database.Scope
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&update); err != nil {
 		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
 		return
 	}
 	defer r.Body.Close()
 
-	database.CreateScope(*s.Name, *s.Description)
+	update.ID = s.ID
+	renamed := update.Name != nil && *update.Name != *s.Name
+	if renamed {
+		if *s.Name == authentication.PassportScope { // nobody could manage anything anymore
+			res.New(http.StatusForbidden).SetErrorMessage("Passport Scope Can't Be Renamed").Error(w)
+			return
+		}
+		if !util.IsValidScopeName(*update.Name) {
+			res.New(http.StatusBadRequest).SetErrorMessage("Invalid Scope Name").Error(w)
+			return
+		}
+		if response := scopeNameTaken(update.Name); response != nil {
+			response.Error(w)
+			return
+		}
+	}
+
+	if serr := update.UpdateScope(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if renamed {
+		revoke, response := scopeTokenRevoker(s)
+		if response == nil {
+			response = revoke()
+		}
+		if response != nil {
+			response.Error(w)
+			return
+		}
+	}
+
+	if serr := s.GetScope(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditScope, Detail: "updated " + *s.Name})
+
+	res.New(http.StatusOK).SetScope(s).JSON(w)
+}
+
+// delete
+func deleteScope(w http.ResponseWriter, r *http.Request) {
+	s, response := scopeFromRequest(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if *s.Name == authentication.PassportScope {
+		res.New(http.StatusForbidden).SetErrorMessage("Passport Scope Can't Be Deleted").Error(w)
+		return
+	}
+
+	// find out who's losing it before the permissions are gone
+	revoke, response := scopeTokenRevoker(s)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if serr := s.DeleteScope(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if response := revoke(); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditScope, Detail: "deleted " + *s.Name})
 
-	res.New(http.StatusOK).JSON(w)
+	res.New(http.StatusAccepted).JSON(w)
 }
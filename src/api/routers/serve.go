@@ -5,7 +5,9 @@ import (
 	"net/http"
 
 	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
 	"github.com/IWannaCommunity/gate-jump/src/api/log"
+	"github.com/IWannaCommunity/gate-jump/src/api/ratelimit"
 	"github.com/IWannaCommunity/gate-jump/src/api/res"
 	"github.com/IWannaCommunity/gate-jump/src/api/settings"
 	"github.com/gorilla/handlers"
@@ -16,22 +18,79 @@ var router *mux.Router
 
 func Serve(port, sslport string) {
 	router = mux.NewRouter()
+	passport := authentication.RequireScope(authentication.PassportScope)
 
 	router.HandleFunc("/", getAlive).Methods("GET")
 	router.HandleFunc("/user", getUsers).Methods("GET")
 	router.HandleFunc("/register", createUser).Methods("POST")
 	router.HandleFunc("/login", validateUser).Methods("POST")
+	router.HandleFunc("/login/mfa", validateMFA).Methods("POST")
+	router.HandleFunc("/login/webauthn/options", beginWebAuthnLogin).Methods("POST")
+	router.HandleFunc("/login/webauthn", finishWebAuthnLogin).Methods("POST")
 	router.HandleFunc("/refresh", refreshUser).Methods("POST")
+	router.HandleFunc("/logout", logoutUser).Methods("POST")
 	router.HandleFunc("/user/{id:[0-9]+}", getUser).Methods("GET")
 	router.HandleFunc("/user/{id:[0-9]+}", updateUser).Methods("PUT")
 	router.HandleFunc("/user/{id:[0-9]+}", deleteUser).Methods("DELETE")
-	//router.HandleFunc("/user/{id:[0-9]+}", banUser).Methods("POST")
+	router.Handle("/user/{id:[0-9]+}/ban", passport(http.HandlerFunc(banUser))).Methods("POST")
+	router.Handle("/user/{id:[0-9]+}/ban", passport(http.HandlerFunc(unbanUser))).Methods("DELETE")
 	router.HandleFunc("/user/{name}", getUserByName).Methods("GET")
+	router.HandleFunc("/verify/resend", resendVerification).Methods("POST")
 	router.HandleFunc("/verify/{magic}", verifyUser).Methods("GET")
-	router.HandleFunc("/scope", createScope).Methods("POST")
+	router.HandleFunc("/email/confirm/{magic}", confirmEmail).Methods("GET")
+	router.HandleFunc("/email/undo/{magic}", undoEmail).Methods("GET")
+	router.HandleFunc("/password/forgot", forgotPassword).Methods("POST")
+	router.HandleFunc("/password/reset/{magic}", resetPassword).Methods("POST")
+	router.Handle("/scope", passport(http.HandlerFunc(createScope))).Methods("POST")
+	router.Handle("/scope", passport(http.HandlerFunc(getScopes))).Methods("GET")
+	router.Handle("/scope/{id:[0-9]+}", passport(http.HandlerFunc(getScope))).Methods("GET")
+	router.Handle("/scope/{id:[0-9]+}", passport(http.HandlerFunc(updateScope))).Methods("PUT")
+	router.Handle("/scope/{id:[0-9]+}", passport(http.HandlerFunc(deleteScope))).Methods("DELETE")
+	router.Handle("/application", passport(http.HandlerFunc(createApplication))).Methods("POST")
+	router.Handle("/application", passport(http.HandlerFunc(getApplications))).Methods("GET")
+	router.Handle("/application/{id:[0-9]+}", passport(http.HandlerFunc(getApplication))).Methods("GET")
+	router.Handle("/application/{id:[0-9]+}", passport(http.HandlerFunc(updateApplication))).Methods("PUT")
+	router.Handle("/application/{id:[0-9]+}", passport(http.HandlerFunc(deleteApplication))).Methods("DELETE")
+	router.Handle("/application/{id:[0-9]+}/secret", passport(http.HandlerFunc(rotateApplicationSecret))).Methods("POST")
+	router.Handle("/application/{id:[0-9]+}/scope/{sid:[0-9]+}", passport(http.HandlerFunc(attachApplicationScope))).Methods("PUT")
+	router.Handle("/application/{id:[0-9]+}/scope/{sid:[0-9]+}", passport(http.HandlerFunc(detachApplicationScope))).Methods("DELETE")
+	router.Handle("/group", passport(http.HandlerFunc(createGroup))).Methods("POST")
+	router.Handle("/group", passport(http.HandlerFunc(getGroups))).Methods("GET")
+	router.Handle("/group/{id:[0-9]+}", passport(http.HandlerFunc(getGroup))).Methods("GET")
+	router.Handle("/group/{id:[0-9]+}", passport(http.HandlerFunc(updateGroup))).Methods("PUT")
+	router.Handle("/group/{id:[0-9]+}", passport(http.HandlerFunc(deleteGroup))).Methods("DELETE")
+	router.Handle("/group/{id:[0-9]+}/scope/{sid:[0-9]+}", passport(http.HandlerFunc(attachGroupScope))).Methods("PUT")
+	router.Handle("/group/{id:[0-9]+}/scope/{sid:[0-9]+}", passport(http.HandlerFunc(detachGroupScope))).Methods("DELETE")
+	router.Handle("/group/{id:[0-9]+}/member/{uid:[0-9]+}", passport(http.HandlerFunc(addGroupMember))).Methods("PUT")
+	router.Handle("/group/{id:[0-9]+}/member/{uid:[0-9]+}", passport(http.HandlerFunc(removeGroupMember))).Methods("DELETE")
+	router.Handle("/audit", passport(http.HandlerFunc(getAuditEvents))).Methods("GET")
+	router.HandleFunc("/oauth/authorize", authorizeApplication).Methods("GET")
+	router.HandleFunc("/oauth/authorize", grantAuthorization).Methods("POST")
+	router.HandleFunc("/oauth/token", issueToken).Methods("POST")
+	router.HandleFunc("/oauth/introspect", introspectToken).Methods("POST")
+	router.HandleFunc("/.well-known/openid-configuration", getOpenIDConfiguration).Methods("GET")
+	router.HandleFunc("/.well-known/jwks.json", getJWKS).Methods("GET")
+	router.HandleFunc("/userinfo", getUserInfo).Methods("GET", "POST")
+	router.HandleFunc("/user/{id:[0-9]+}/sessions", getSessions).Methods("GET")
+	router.HandleFunc("/user/{id:[0-9]+}/sessions", deleteSessions).Methods("DELETE")
+	router.HandleFunc("/user/{id:[0-9]+}/sessions/{sid:[0-9]+}", deleteSession).Methods("DELETE")
+	router.HandleFunc("/user/{id:[0-9]+}/grants", getGrants).Methods("GET")
+	router.HandleFunc("/user/{id:[0-9]+}/grants/{aid:[0-9]+}", revokeGrant).Methods("DELETE")
+	router.HandleFunc("/user/{id:[0-9]+}/totp", enrollTOTP).Methods("POST")
+	router.HandleFunc("/user/{id:[0-9]+}/totp", confirmTOTP).Methods("PUT")
+	router.HandleFunc("/user/{id:[0-9]+}/totp", disableTOTP).Methods("DELETE")
+	router.HandleFunc("/user/{id:[0-9]+}/totp/recovery", regenerateRecoveryCodes).Methods("POST")
+	router.HandleFunc("/user/{id:[0-9]+}/webauthn", getWebAuthnCredentials).Methods("GET")
+	router.HandleFunc("/user/{id:[0-9]+}/webauthn/register", beginWebAuthnRegistration).Methods("POST")
+	router.HandleFunc("/user/{id:[0-9]+}/webauthn/register", finishWebAuthnRegistration).Methods("PUT")
+	router.HandleFunc("/user/{id:[0-9]+}/webauthn/{cid:[0-9]+}", deleteWebAuthnCredential).Methods("DELETE")
 	router.Use(HTTPRecovery)
+	router.Use(rateLimiter().Middleware)
 	router.Use(authentication.JWTContext)
 
+	authentication.SetSessionStore(database.LoginStore{})
+	authentication.SetRevocationStore(database.TokenStore{})
+
 	if settings.Https.CertFile != "" && settings.Https.KeyFile != "" {
 		log.Info("HTTPS Credentials picked up, running HTTPS")
 		log.Fatal(http.ListenAndServeTLS(":"+sslport,
@@ -45,6 +104,27 @@ func Serve(port, sslport string) {
 
 }
 
+// routes for signing up, signing in and getting back in, a token doesn't make them anybody else's
+var credentialRoutes = map[string]bool{"/register": true, "/login": true, "/password": true, "/verify": true}
+
+// builds the rate limiter from the configured limits
+func rateLimiter() *ratelimit.Limiter {
+	policy := func(route string) ratelimit.Policy {
+		limit := settings.RateLimits[route]
+		return ratelimit.Policy{Name: route, Requests: limit.Requests, Per: limit.Per, ByAddress: credentialRoutes[route]}
+	}
+
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), policy("default"))
+	limiter.IP = requestIP
+	for route := range settings.RateLimits {
+		if route != "default" {
+			limiter.Route(route, policy(route))
+		}
+	}
+	go limiter.Daemon()
+	return limiter
+}
+
 func HTTPRecovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
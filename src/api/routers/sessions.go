@@ -0,0 +1,116 @@
+package routers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/gorilla/mux"
+)
+
+// the user agent to store with a login, cut down to what fits in the column
+func userAgent(r *http.Request) *string {
+	agent := r.UserAgent()
+	if agent == "" {
+		return nil
+	}
+	if len(agent) > 512 {
+		agent = agent[:512]
+	}
+	return &agent
+}
+
+// confirms the token's user is the user in the url, or an admin looking at them
+func sessionOwner(r *http.Request) (database.User, *res.Response) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return database.User{}, res.New(http.StatusBadRequest).SetErrorMessage("Invalid User ID")
+	}
+
+	u := database.User{ID: int64(id)}
+
+	auth, response := getAuthLevel(r, &u)
+	if response != nil {
+		return u, response
+	}
+	if auth < authentication.USER {
+		return u, res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Permissions")
+	}
+	return u, nil
+}
+
+// list where the user is signed in
+func getSessions(w http.ResponseWriter, r *http.Request) {
+	u, response := sessionOwner(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	logins, serr := database.GetLogins(u.ID)
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	ctx := r.Context().Value(authentication.CLAIMS).(authentication.Context)
+	for i := range logins {
+		logins[i].Current = logins[i].ID == ctx.Claims.Session
+	}
+
+	res.New(http.StatusOK).SetSessions(logins).JSON(w)
+}
+
+// sign out a single session
+func deleteSession(w http.ResponseWriter, r *http.Request) {
+	u, response := sessionOwner(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	sid, err := strconv.Atoi(vars["sid"])
+	if err != nil {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Session ID").Error(w)
+		return
+	}
+
+	login := database.Login{ID: int64(sid)}
+	if serr := login.GetLogin(); serr.Err == sql.ErrNoRows || (serr.Err == nil && login.UserID != u.ID) {
+		res.New(http.StatusNotFound).SetErrorMessage("Session Not Found").Error(w)
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	if serr := login.RevokeLogin(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditSessions, Target: &u.ID, Detail: "signed out session " + strconv.FormatInt(login.ID, 10)})
+
+	res.New(http.StatusAccepted).JSON(w)
+}
+
+// sign out everywhere
+func deleteSessions(w http.ResponseWriter, r *http.Request) {
+	u, response := sessionOwner(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if response := revokeUser(u.ID); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditSessions, Target: &u.ID, Detail: "signed out everywhere"})
+
+	res.New(http.StatusAccepted).JSON(w)
+}
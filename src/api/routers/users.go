@@ -3,6 +3,9 @@ package routers
 import (
 	"database/sql"
 	"encoding/json"
+	"io"
+	"math"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -20,12 +23,29 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// how long an email verification link works for after it's sent
+	verifyLinkLifetime = time.Hour * 24 * 7
+	// how many verification links can go to a user or an address in verifyResendWindow
+	verifyResendLimit  = 3
+	verifyResendWindow = time.Hour
+)
+
+// checked against when there's no user by the name given, so a missing user takes as long to
+// answer as a wrong password
+var loginTimingHash, _ = bcrypt.GenerateFromPassword([]byte("gate-jump"), 12)
+
 // LoginRequest is the request expected on /login
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
 
+// RefreshRequest is the request expected on /refresh
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 // is the server alive
 func getAlive(w http.ResponseWriter, r *http.Request) {
 	defer log.Bench(time.Now(), "api/v0", r.RemoteAddr, http.StatusOK)
@@ -123,12 +143,6 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 
 	checkuser := u
 
-	// Generate a random string that will be used for email verification in the background
-	ml := *new(database.MagicLink)
-	cherr := make(chan error)
-	chstr := make(chan []byte)
-	go util.CreateRandomString(32, 1, chstr, cherr)
-
 	// Validate user input
 	if !util.IsValidUsername(*checkuser.Name) || util.IsValidEmail(*checkuser.Name) {
 		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Username Format").Error(w)
@@ -174,30 +188,35 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
 		return
 	}
+	audit(r, database.AuditEvent{Type: database.AuditRegister, Actor: &u.ID, Target: &u.ID})
 
-	// create a new magic link
-	err = <-cherr
-	if err != nil {
-		// we can't "fail" here, so we will pass and ask them manually ask for a new magiclink
-		log.Error("Could not generate a random magiclink string, %v", err)
+	res.New(http.StatusCreated).JSON(w)
+
+	// we can't "fail" here, they can ask for a new link on /verify/resend
+	if serr := sendVerificationLink(database.User{ID: u.ID, Email: checkuser.Email}); serr.Err != nil {
+		log.Error("Could not send a verification link, %v", serr.Err)
 	}
+}
 
-	// TODO: Probably don't need strings.Builder, maybe do string(<-chstr)
-	buf := new(strings.Builder)
-	buf.Write(<-chstr)
-	ml.UserID = u.ID
-	ml.Magic = buf.String()
+// makes a new verification link for the user and mails it to them, older links stop working
+func sendVerificationLink(u database.User) res.ServerError {
+	if serr := database.ExpireMagicLinks(u.ID, database.MagicVerify); serr.Err != nil {
+		return serr
+	}
+
+	magic, err := util.CreateSecureString(32)
+	if err != nil {
+		return res.ServerError{Err: err}
+	}
+	ml := database.MagicLink{UserID: u.ID, Magic: magic, Purpose: database.MagicVerify, Email: *u.Email, ExpiresAt: time.Now().Add(verifyLinkLifetime)}
 	if serr := ml.CreateMagicLink(); serr.Err != nil {
-		// can't fail here either
-		log.Error("Could not create a magiclink, %v", serr.Err)
+		return serr
 	}
 	log.Info("New Magiclink ID: ", ml.ID)
 
-	res.New(http.StatusCreated).JSON(w)
-
 	msg := smtp.NewMessage()
 	msg.SetHeader("From", settings.Mailer.User)
-	msg.SetHeader("To", *checkuser.Email)
+	msg.SetHeader("To", *u.Email)
 	msg.SetHeader("Subject", "Account Verification for I Wanna Community")
 	// TODO: Change the URL here, hardcoded for now...
 	msg.SetBody("text/plain", `In order to complete account registration,
@@ -205,23 +224,91 @@ func createUser(w http.ResponseWriter, r *http.Request) {
 
 		https://localhost:80/verify/`+ml.Magic)
 	mailer.Outbox <- msg
+	return res.ServerError{}
 }
 
-// verifyUser verifies the user's account
-func verifyUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	str := vars["magic"]
+// sends the signed in user a new verification link, in case the first one never showed up
+func resendVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context().Value(authentication.CLAIMS).(authentication.Context) // confirmed valid on jwt layer
+
+	if ctx.Claims.ID == 0 || ctx.Claims.Audience != "" {
+		res.New(http.StatusUnauthorized).SetErrorMessage("Login Required").Error(w)
+		return
+	}
 
-	ml := database.MagicLink{Magic: str}
-	serr := ml.GetMagicLinkFromMagicString()
+	u := database.User{ID: ctx.Claims.ID}
+	if serr := u.GetUser(authentication.SERVER); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if u.Verified != nil && *u.Verified {
+		res.New(http.StatusConflict).SetErrorMessage("Already Verified").Error(w)
+		return
+	}
 
+	// counted by user and by address, so neither can be used to flood an inbox
+	sent, serr := database.CountMagicLinks(u.ID, *u.Email, database.MagicVerify, time.Now().Add(-verifyResendWindow))
 	if serr.Err != nil {
 		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
 		return
 	}
+	if sent >= verifyResendLimit {
+		res.New(http.StatusTooManyRequests).SetErrorMessage("Too Many Requests").Error(w)
+		return
+	}
+
+	if serr := sendVerificationLink(u); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	res.New(http.StatusAccepted).JSON(w)
+}
+
+// looks up the link in the url sent for purpose and marks it used, writing out the error if it
+// can't be used. check gets a say before the link is burnt, a response from it is written out instead
+func useMagicLink(w http.ResponseWriter, r *http.Request, purpose string, check func(database.MagicLink) *res.Response) (database.MagicLink, bool) {
+	vars := mux.Vars(r)
+
+	ml := database.MagicLink{Magic: vars["magic"], Purpose: purpose}
+	if serr := ml.GetMagicLinkFromMagicString(); serr.Err == sql.ErrNoRows {
+		res.New(http.StatusNotFound).SetErrorMessage("Link Not Found").Error(w)
+		return ml, false
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return ml, false
+	}
+	if !ml.Usable() {
+		res.New(http.StatusGone).SetErrorMessage("Link Expired").Error(w)
+		return ml, false
+	}
+	if check != nil {
+		if response := check(ml); response != nil {
+			response.Error(w)
+			return ml, false
+		}
+	}
+
+	// the link is only good once, whoever marks it used gets to use it
+	if serr := ml.UseMagicLink(); serr.Err == sql.ErrNoRows {
+		res.New(http.StatusGone).SetErrorMessage("Link Expired").Error(w)
+		return ml, false
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return ml, false
+	}
+	return ml, true
+}
+
+// verifyUser verifies the user's account
+func verifyUser(w http.ResponseWriter, r *http.Request) {
+	ml, ok := useMagicLink(w, r, database.MagicVerify, nil)
+	if !ok {
+		return
+	}
 
 	usr := database.User{ID: ml.UserID}
-	serr = usr.GetUser(authentication.SERVER)
+	serr := usr.GetUser(authentication.SERVER)
 
 	if serr.Err != nil {
 		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
@@ -238,12 +325,7 @@ func verifyUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// delete the link from the database, we can fail here without panicing
-	serr = ml.DeleteMagicLinkFromMagicString()
-
-	if serr.Err != nil {
-		log.Warning("Unable to delete a magic link from the database, %v", serr.Err)
-	}
+	audit(r, database.AuditEvent{Type: database.AuditVerify, Actor: &usr.ID, Target: &usr.ID})
 
 	// send a successful registration email
 	msg := smtp.NewMessage()
@@ -286,17 +368,74 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if u.Name != nil || u.Email != nil { // confirm unique email and username
+	if u.Name != nil { // confirm unique username
+		other := database.User{Name: u.Name}
+		if serr := other.GetUserByName(authentication.SERVER); serr.Err == nil && other.ID != u.ID {
+			res.New(http.StatusConflict).SetErrorMessage("Username Already Exists").Error(w)
+			return
+		} else if serr.Err != nil && serr.Err != sql.ErrNoRows {
+			res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+			return
+		}
+	}
+
+	// a new email isn't written here, it waits on a confirmation link sent to it. only the user
+	// can ask for that, nobody else would be the one getting the link
+	var oldEmail, newEmail string
+	if u.Email != nil && !(auth == authentication.USER || auth == authentication.ADMINUSER) {
+		res.New(http.StatusForbidden).SetErrorMessage("Cannot Change Email").Error(w)
+		return
+	}
+	if u.Email != nil {
+		if !util.IsValidEmail(*u.Email) {
+			res.New(http.StatusBadRequest).SetErrorMessage("Invalid Email Format").Error(w)
+			return
+		}
+
+		current := database.User{ID: u.ID}
+		if serr := current.GetUser(authentication.SERVER); serr.Err != nil {
+			res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+			return
+		}
+
+		if current.Email == nil || *current.Email != *u.Email {
+			other := database.User{Email: u.Email}
+			if serr := other.GetUserByEmail(authentication.SERVER); serr.Err == nil {
+				res.New(http.StatusConflict).SetErrorMessage("Email Already In Use").Error(w)
+				return
+			} else if serr.Err != sql.ErrNoRows {
+				res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+				return
+			}
+			if current.Email != nil {
+				oldEmail = *current.Email
+			}
+			newEmail = *u.Email
 
+			// counted by user and by address, so neither can be used to flood an inbox
+			sent, serr := database.CountMagicLinks(u.ID, newEmail, database.MagicEmail, time.Now().Add(-emailChangeWindow))
+			if serr.Err != nil {
+				res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+				return
+			}
+			if sent >= emailChangeLimit {
+				res.New(http.StatusTooManyRequests).SetErrorMessage("Too Many Requests").Error(w)
+				return
+			}
+		}
 	}
+	u.Email = nil
 
 	//hash the password
-	hashpwd, err := bcrypt.GenerateFromPassword([]byte(*u.Password), 12)
-	if err != nil {
-		res.New(http.StatusInternalServerError).SetErrorMessage("Failed Encrypting Password").Error(w)
-		return
+	changedPassword := u.Password != nil && auth != authentication.ADMIN // admins can't change other users passwords
+	if u.Password != nil {
+		hashpwd, err := bcrypt.GenerateFromPassword([]byte(*u.Password), 12)
+		if err != nil {
+			res.New(http.StatusInternalServerError).SetErrorMessage("Failed Encrypting Password").Error(w)
+			return
+		}
+		*u.Password = string(hashpwd)
 	}
-	*u.Password = string(hashpwd)
 
 	serr := u.UpdateUser(auth)
 	if serr.Err != nil {
@@ -304,6 +443,42 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// UpdateUser clears whatever it didn't write, so what's left is what changed
+	var changed []string
+	if u.Name != nil {
+		changed = append(changed, "name")
+	}
+	if changedPassword {
+		changed = append(changed, "password")
+	}
+	if newEmail != "" {
+		changed = append(changed, "email requested")
+	}
+	if u.Country != nil {
+		changed = append(changed, "country")
+	}
+	if u.Locale != nil {
+		changed = append(changed, "locale")
+	}
+	if len(changed) > 0 {
+		audit(r, database.AuditEvent{Type: database.AuditUpdate, Target: &u.ID, Detail: strings.Join(changed, ", ")})
+	}
+
+	// anything signed in with the old password has to go
+	if changedPassword {
+		if response := revokeUser(u.ID); response != nil {
+			response.Error(w)
+			return
+		}
+	}
+
+	if newEmail != "" {
+		if serr := requestEmailChange(u, oldEmail, newEmail); serr.Err != nil {
+			res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+			return
+		}
+	}
+
 	res.New(http.StatusOK).SetUser(u).JSON(w)
 }
 
@@ -331,6 +506,11 @@ func deleteUser(w http.ResponseWriter, r *http.Request) {
 		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
 		return
 	}
+	if response := revokeUser(u.ID); response != nil {
+		response.Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditDelete, Target: &u.ID})
 	res.New(http.StatusAccepted).JSON(w)
 }
 
@@ -345,39 +525,123 @@ func validateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
+	// too many wrong guesses at the account, or from the address, and they have to wait a while
+	ip := requestIP(r)
+	if wait, err := authentication.LoginWait(lr.Username, ip, time.Now()); err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&res.ServerError{Err: err}).Error(w)
+		return
+	} else if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		res.New(http.StatusTooManyRequests).SetErrorMessage("Too Many Attempts").Error(w)
+		return
+	}
+
 	var u database.User
 	u.Name = &lr.Username
 
-	//get the user; if no user by that name, return 401, if other error, 500
-	if serr := u.GetUserByName(authentication.SERVER); serr.Err == sql.ErrNoRows {
-		res.New(http.StatusUnauthorized).SetErrorMessage("User Doesn't Exist").Error(w)
-		return
-	} else if serr.Err != nil {
+	// a missing user and a wrong password look the same, so nobody can find out who has an account
+	hash := loginTimingHash
+	serr := u.GetUserByName(authentication.SERVER)
+	if serr.Err == nil {
+		hash = []byte(*u.Password)
+	} else if serr.Err != sql.ErrNoRows {
 		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
 		return
 	}
 
-	// check if they are banned
-	if u.Banned != nil && *u.Banned {
-		res.New(http.StatusUnauthorized).SetErrorMessage("Account Banned").Error(w)
+	//check the password
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(lr.Password)); err != nil || serr.Err == sql.ErrNoRows {
+		locked, err := authentication.LoginFailed(lr.Username, ip, time.Now())
+		if err != nil {
+			res.New(http.StatusInternalServerError).SetInternalError(&res.ServerError{Err: err}).Error(w)
+			return
+		}
+		failure := database.AuditEvent{Type: database.AuditLoginFailed, Detail: "unknown user"}
+		if serr.Err == nil {
+			failure.Target = &u.ID
+			failure.Detail = "wrong password"
+		}
+		if locked {
+			failure.Detail += ", locked out"
+		}
+		audit(r, failure)
+		if locked && serr.Err == nil && u.Email != nil {
+			msg := smtp.NewMessage()
+			msg.SetHeader("From", settings.Mailer.User)
+			msg.SetHeader("To", *u.Email)
+			msg.SetHeader("Subject", "Your I Wanna Community Account Was Locked")
+			msg.SetBody("text/plain", "There were too many wrong passwords for "+*u.Name+", so signing in is locked for the next "+strconv.Itoa(int(authentication.LockoutDuration.Minutes()))+" minutes. If this wasn't you, somebody may be guessing at your password, you can choose a new one with the forgot password link.")
+			mailer.Outbox <- msg
+		}
+		res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Username or Password").Error(w)
 		return
 	}
+	if err := authentication.LoginSucceeded(lr.Username); err != nil {
+		log.Error("Could not reset failed logins, %v", err)
+	}
 
-	//check the password
-	if err := bcrypt.CompareHashAndPassword([]byte(*u.Password), []byte(lr.Password)); err != nil {
-		res.New(http.StatusUnauthorized).SetErrorMessage("Wrong Password").Error(w)
+	// check if they are banned, and tell them why
+	if response := checkBan(r, &u); response != nil {
+		response.Error(w)
+		return
+	}
+
+	// the password only gets them halfway if they have two factor on
+	methods, serr := database.MFAMethods(u.ID)
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if len(methods) > 0 {
+		challenge, err := util.CreateSecureString(32)
+		if err != nil {
+			res.New(http.StatusInternalServerError).SetInternalError(&res.ServerError{Err: err}).Error(w)
+			return
+		}
+		c := database.MFAChallenge{Challenge: challenge, UserID: u.ID, Expires: time.Now().Add(mfaChallengeLifetime)}
+		if serr := c.CreateMFAChallenge(); serr.Err != nil {
+			res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+			return
+		}
+		res.New(http.StatusOK).SetChallenge(challenge, methods).JSON(w)
 		return
 	}
 
-	// check if they are deleted, if so undelete them
+	completeLogin(w, r, u)
+}
+
+// signs in a user who has proven who they are, u has to have been read with SERVER
+func completeLogin(w http.ResponseWriter, r *http.Request, u database.User) {
+	// signing in to a deleted account before it's erased restores it, and they're told so in case
+	// it wasn't them
 	if u.Deleted != nil && *u.Deleted {
-		if serr := u.UnflagDeletion(); serr.Err != nil {
+		if serr := u.UnflagDeletion(); serr.Err == sql.ErrNoRows {
+			res.New(http.StatusUnauthorized).SetErrorMessage("Account Erased").Error(w)
+			return
+		} else if serr.Err != nil {
 			res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
 			return
 		}
+		audit(r, database.AuditEvent{Type: database.AuditRestore, Actor: &u.ID, Target: &u.ID})
+
+		if u.Email != nil {
+			msg := smtp.NewMessage()
+			msg.SetHeader("From", settings.Mailer.User)
+			msg.SetHeader("To", *u.Email)
+			msg.SetHeader("Subject", "Your I Wanna Community Account Was Restored")
+			msg.SetBody("text/plain", "Somebody signed in to "+*u.Name+" after it was deleted, so it has been restored and won't be erased. If this wasn't you, change your password and delete the account again.")
+			mailer.Outbox <- msg
+		}
 	}
 
-	signedToken, err := u.CreateToken()
+	// start a new login, its refresh token keeps them signed in after the bearer token expires
+	login := database.Login{UserID: u.ID, UserUUID: *u.UUID, IP: requestIP(r), UserAgent: userAgent(r)}
+	if serr := login.CreateLogin(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	signedToken, err := u.CreateToken(database.TokenOptions{Session: login.ID})
 	if err != nil {
 		res.New(http.StatusInternalServerError).SetErrorMessage("Failed Creating Token").Error(w)
 		return
@@ -385,21 +649,73 @@ func validateUser(w http.ResponseWriter, r *http.Request) {
 
 	u.LastToken = &signedToken
 	u.LastLogin = &[]time.Time{time.Now()}[0] // how to get pointer from function call (its gross): goo.gl/9BXtsj
-	u.LastIP = &r.RemoteAddr
+	u.LastIP = &[]string{requestIP(r).String()}[0]
 	if serr := u.UpdateUser(authentication.SERVER); serr.Err != nil {
 		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
 		return
 	}
+	audit(r, database.AuditEvent{Type: database.AuditLogin, Actor: &u.ID, Target: &u.ID})
 
-	res.New(http.StatusOK).SetToken(signedToken).JSON(w)
+	res.New(http.StatusOK).SetToken(signedToken).SetRefreshToken(login.Token).JSON(w)
+}
+
+// logout
+func logoutUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context().Value(authentication.CLAIMS).(authentication.Context) // confirmed valid on jwt layer
+
+	if ctx.Claims.ID == 0 {
+		res.New(http.StatusUnauthorized).SetErrorMessage("Login Required").Error(w)
+		return
+	}
+
+	// the refresh token goes with the session, so it can't be used to get back in
+	if ctx.Claims.Session != 0 {
+		login := database.Login{ID: ctx.Claims.Session}
+		if serr := login.RevokeLogin(); serr.Err != nil {
+			res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+			return
+		}
+	}
+
+	if ctx.Claims.Id != "" {
+		token := authentication.RevokedToken{ID: ctx.Claims.Id, Expires: time.Unix(ctx.Claims.ExpiresAt, 0)}
+		if err := authentication.Revoke(token); err != nil {
+			res.New(http.StatusInternalServerError).SetInternalError(&res.ServerError{Err: err}).Error(w)
+			return
+		}
+	}
+	audit(r, database.AuditEvent{Type: database.AuditLogout, Target: &ctx.Claims.ID})
+
+	res.New(http.StatusAccepted).JSON(w)
 }
 
 // refreshUser refresh the users bearer token
 func refreshUser(w http.ResponseWriter, r *http.Request) {
+	var rr RefreshRequest
+
+	// an empty body means they're refreshing with a bearer token that's still valid
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&rr); err != nil && err != io.EOF {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	if rr.RefreshToken != "" {
+		refreshLogin(w, r, rr.RefreshToken)
+		return
+	}
+
 	// get user
 	ctx := r.Context().Value(authentication.CLAIMS).(authentication.Context) // claims at this point are validated so refresh is allowed
 	claims := ctx.Claims
 
+	// application tokens are refreshed through /oauth/token, here they'd come back with every scope
+	if claims.Audience != "" || claims.Client != "" {
+		res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Token Provided").Error(w)
+		return
+	}
+
 	var u database.User
 	u.ID = claims.ID
 
@@ -420,7 +736,7 @@ func refreshUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// make token
-	token, err := u.CreateToken()
+	token, err := u.CreateToken(database.TokenOptions{Session: claims.Session})
 	if err != nil {
 		res.New(http.StatusInternalServerError).SetErrorMessage("Error Creating Token").Error(w)
 		return
@@ -429,27 +745,91 @@ func refreshUser(w http.ResponseWriter, r *http.Request) {
 	// update login information
 	u.LastToken = &token
 	u.LastLogin = &[]time.Time{time.Now()}[0] // how to get pointer from function call (its gross): goo.gl/9BXtsj
-	u.LastIP = &r.RemoteAddr
+	u.LastIP = &[]string{requestIP(r).String()}[0]
 
 	// update information
 	if serr := u.UpdateUser(authentication.SERVER); serr.Err != nil {
 		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
 		return
 	}
+	audit(r, database.AuditEvent{Type: database.AuditRefresh, Target: &u.ID})
 
 	// return token
 	res.New(http.StatusOK).SetToken(token).JSON(w)
 }
 
+// trades a refresh token for a new bearer token and refresh token
+func refreshLogin(w http.ResponseWriter, r *http.Request, refreshToken string) {
+	login := database.Login{Token: refreshToken}
+	if serr := login.RotateLogin(); serr.Err == sql.ErrNoRows {
+		res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Refresh Token").Error(w)
+		return
+	} else if serr.Err == database.ErrRefreshTokenReused {
+		audit(r, database.AuditEvent{Type: database.AuditRefresh, Target: &login.UserID, Detail: "refresh token reused, session revoked"})
+		res.New(http.StatusUnauthorized).SetErrorMessage("Refresh Token Reused").Error(w)
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	u := database.User{ID: login.UserID}
+	if serr := u.GetUser(authentication.USER); serr.Err == sql.ErrNoRows { // deleted users have to log back in
+		res.New(http.StatusUnauthorized).SetErrorMessage("User Doesn't Exist").Error(w)
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	if response := checkBan(r, &u); response != nil {
+		response.Error(w)
+		return
+	}
+
+	token, err := u.CreateToken(database.TokenOptions{Session: login.ID})
+	if err != nil {
+		res.New(http.StatusInternalServerError).SetErrorMessage("Error Creating Token").Error(w)
+		return
+	}
+
+	// update login information
+	u.LastToken = &token
+	u.LastLogin = &[]time.Time{time.Now()}[0] // how to get pointer from function call (its gross): goo.gl/9BXtsj
+	u.LastIP = &[]string{requestIP(r).String()}[0]
+	if serr := u.UpdateUser(authentication.SERVER); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditRefresh, Actor: &u.ID, Target: &u.ID})
+
+	res.New(http.StatusOK).SetToken(token).SetRefreshToken(login.Token).JSON(w)
+}
+
+// the address of the client, through any trusted proxies and without the port
+func requestIP(r *http.Request) net.IP {
+	return util.ClientIP(r, settings.TrustedProxies)
+}
+
 // provide with request and said user and claims and confirm claims user exists and claims user's authentication level
 //TODO: move this function to the authentication package so we can unexport ctx.Claims and ctx.Tokens
 func getAuthLevel(r *http.Request, u1 *database.User) (authentication.Level, *res.Response) {
 	ctx := r.Context().Value(authentication.CLAIMS).(authentication.Context) // confirmed valid on jwt layer
 
+	if ctx.Claims.Client != "" { // an application acting as itself, it can manage users like an admin if it was trusted to
+		if authentication.HasScope(ctx.Claims.Scope, authentication.UsersScope) {
+			return authentication.ADMIN, nil
+		}
+		return authentication.PUBLIC, nil
+	}
+
 	if ctx.Claims.ID == 0 { // no claims exist
 		return authentication.PUBLIC, nil
 	}
 
+	if ctx.Claims.Audience != "" { // an application signed in as the user, it only gets what its scopes allow
+		return authentication.PUBLIC, nil
+	}
+
 	var u2 database.User
 	u2.ID = ctx.Claims.ID
 	serr := u2.GetUser(authentication.SERVER)
@@ -464,22 +844,35 @@ func getAuthLevel(r *http.Request, u1 *database.User) (authentication.Level, *re
 		return authentication.PUBLIC, nil
 	}
 
+	admin := authentication.HasScope(ctx.Claims.Scope, authentication.PassportScope) // admins hold the passport scope
+
 	if u1 == nil { // we aren't editing a user directly so no user was provided
-		if u2.Admin != nil && *u2.Admin { // u2 is an admin
+		if admin { // u2 is an admin
 			return authentication.ADMIN, nil
 		} else { // u2 is not an admin
 			return authentication.PUBLIC, nil
 		}
 	} else {
 		if u1.ID == u2.ID { // is u1 u2?
-			if u2.Admin != nil && *u2.Admin { // is u2 an admin like they say they are?
+			if admin { // is u2 an admin like they say they are?
 				return authentication.ADMINUSER, nil
 			} else { // u2 is not an admin but is u1
 				return authentication.USER, nil
 			}
-		} else if u2.Admin != nil && *u2.Admin { // is u2 not u1 but is an admin?
+		} else if admin { // is u2 not u1 but is an admin?
 			return authentication.ADMIN, nil
 		}
 		return authentication.PUBLIC, nil // u2 is neither u1 or an admin
 	}
 }
+
+// signs the user out everywhere, revoking every token and refresh token they have
+func revokeUser(userID int64) *res.Response {
+	if err := authentication.RevokeUser(userID); err != nil {
+		return res.New(http.StatusInternalServerError).SetInternalError(&res.ServerError{Err: err})
+	}
+	if serr := database.RevokeLogins(userID); serr.Err != nil {
+		return res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	return nil
+}
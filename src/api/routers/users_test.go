@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
 	"github.com/IWannaCommunity/gate-jump/src/api/mailer"
 	"github.com/IWannaCommunity/gate-jump/src/api/settings"
 
@@ -25,6 +27,10 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		log.Fatal(err) // clearly couldn't get database variables
 	}
+	for route, limit := range settings.RateLimits { // the tests make more requests from one place than anyone should
+		limit.Requests = 10000
+		settings.RateLimits[route] = limit
+	}
 
 	go database.Connect("root", "", "gatejump") // connect the database for the database package
 	go Serve("10421", "444")                    // run router on port
@@ -163,3 +169,213 @@ func TestCreateUser(t *testing.T) {
 		assert.Nil(t, r.Response.UserList)
 	}
 }
+
+// registers the main test user and reads them back, the database is cleared first
+func prepareTestUser(t *testing.T) database.User {
+	te.Prepare("", "")
+	return registerTestUser(t, "test_user", "email@website.com")
+}
+
+// registers a user with the password 12345678 and reads them back
+func registerTestUser(t *testing.T, name, email string) database.User {
+	te.Target("POST", "/register")
+	r := te.Request([]byte(`{"name":"` + name + `","password":"12345678","email":"` + email + `"}`))
+	if !assert.NoError(t, r.Err, te.Expect()) || !assert.Equal(t, http.StatusCreated, r.Code, te.Expect()) {
+		t.FailNow()
+	}
+
+	u := database.User{Name: &name}
+	if serr := u.GetUserByName(authentication.SERVER); serr.Err != nil {
+		t.Fatal(serr.Err)
+	}
+	return u
+}
+
+func TestApplicationTokenOnUserRoutes(t *testing.T) {
+	u := prepareTestUser(t)
+
+	appToken, err := u.CreateToken(database.TokenOptions{Audience: "test_client", Scope: "openid profile"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userToken, err := u.CreateToken(database.TokenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an application signed in as the user can't manage their account
+	te.Target("PUT", fmt.Sprintf("/user/%d", u.ID))
+	te.Authorize(appToken)
+	r := te.Request([]byte(`{"country":"us"}`))
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusUnauthorized, r.Code, te.Expect())
+		assert.False(t, r.Response.Success, te.Expect())
+		if assert.NotNil(t, r.Response.Error, te.Expect()) {
+			assert.Equal(t, "Requires User Permissions", *r.Response.Error, te.Expect())
+		}
+	}
+
+	// nor trade its token for one of the user's own
+	te.Target("POST", "/refresh")
+	r = te.Request(nil)
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusUnauthorized, r.Code, te.Expect())
+		assert.Nil(t, r.Response.Token, te.Expect())
+	}
+
+	// the user can
+	te.Target("PUT", fmt.Sprintf("/user/%d", u.ID))
+	te.Authorize(userToken)
+	r = te.Request([]byte(`{"country":"us"}`))
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusOK, r.Code, te.Expect())
+		assert.True(t, r.Response.Success, te.Expect())
+	}
+}
+
+func TestClientTokenOnUserRoutes(t *testing.T) {
+	u := prepareTestUser(t)
+	app := prepareTestApplication(t)
+	clientToken, err := app.CreateToken(authentication.UsersScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an application managing users gets what an admin would, not a say over how they sign in
+	te.Target("PUT", fmt.Sprintf("/user/%d", u.ID))
+	te.Authorize(clientToken)
+	r := te.Request([]byte(`{"name":"renamed_user","verified":true,"password":"87654321","last_ip":"10.0.0.1"}`))
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusOK, r.Code, te.Expect())
+		assert.True(t, r.Response.Success, te.Expect())
+	}
+	if serr := u.GetUser(authentication.SERVER); assert.NoError(t, serr.Err) {
+		assert.Equal(t, "renamed_user", *u.Name)
+		assert.False(t, *u.Verified)
+		assert.Nil(t, u.LastIP)
+	}
+
+	te.Authorize("")
+	te.Target("POST", "/login")
+	assertError(t, te.Request([]byte(`{"username":"renamed_user","password":"87654321"}`)), http.StatusUnauthorized, "Invalid Username or Password")
+}
+
+// makes a magic link for the user, expired links are made already past their expiry
+func createTestLink(t *testing.T, u database.User, magic, purpose, email string, expired bool) {
+	expires := time.Now().Add(time.Hour)
+	if expired {
+		expires = time.Now().Add(-time.Hour)
+	}
+	ml := database.MagicLink{UserID: u.ID, Magic: magic, Purpose: purpose, Email: email, ExpiresAt: expires}
+	if serr := ml.CreateMagicLink(); serr.Err != nil {
+		t.Fatal(serr.Err)
+	}
+}
+
+// checks the request was turned away with the given code and error
+func assertError(t *testing.T, r tst.TestPayload, code int, message string) {
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, code, r.Code, te.Expect())
+		assert.False(t, r.Response.Success, te.Expect())
+		if assert.NotNil(t, r.Response.Error, te.Expect()) {
+			assert.Equal(t, message, *r.Response.Error, te.Expect())
+		}
+	}
+}
+
+func TestVerifyUser(t *testing.T) {
+	u := prepareTestUser(t)
+	createTestLink(t, u, "expired_verify_link", database.MagicVerify, *u.Email, true)
+	createTestLink(t, u, "good_verify_link", database.MagicVerify, *u.Email, false)
+	createTestLink(t, u, "good_reset_link", database.MagicReset, *u.Email, false)
+
+	te.Target("GET", "/verify/no_such_link")
+	assertError(t, te.Request(nil), http.StatusNotFound, "Link Not Found")
+
+	// a link only works for what it was sent for
+	te.Target("GET", "/verify/good_reset_link")
+	assertError(t, te.Request(nil), http.StatusNotFound, "Link Not Found")
+
+	te.Target("GET", "/verify/expired_verify_link")
+	assertError(t, te.Request(nil), http.StatusGone, "Link Expired")
+
+	te.Target("GET", "/verify/good_verify_link")
+	r := te.Request(nil)
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusAccepted, r.Code, te.Expect())
+		assert.True(t, r.Response.Success, te.Expect())
+	}
+	if serr := u.GetUser(authentication.SERVER); assert.NoError(t, serr.Err) {
+		assert.True(t, *u.Verified)
+	}
+
+	// the link is only good once
+	assertError(t, te.Request(nil), http.StatusGone, "Link Expired")
+}
+
+func TestResetPassword(t *testing.T) {
+	u := prepareTestUser(t)
+	createTestLink(t, u, "expired_reset_link", database.MagicReset, *u.Email, true)
+	createTestLink(t, u, "good_reset_link", database.MagicReset, *u.Email, false)
+	newPassword := []byte(`{"password":"87654321"}`)
+
+	te.Target("POST", "/password/reset/no_such_link")
+	assertError(t, te.Request(newPassword), http.StatusNotFound, "Link Not Found")
+
+	te.Target("POST", "/password/reset/expired_reset_link")
+	assertError(t, te.Request(newPassword), http.StatusGone, "Link Expired")
+
+	// a bad password doesn't use up the link
+	te.Target("POST", "/password/reset/good_reset_link")
+	assertError(t, te.Request([]byte(`{"password":"1234"}`)), http.StatusBadRequest, "Invalid Password Format")
+
+	r := te.Request(newPassword)
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusAccepted, r.Code, te.Expect())
+		assert.True(t, r.Response.Success, te.Expect())
+	}
+	assertError(t, te.Request(newPassword), http.StatusGone, "Link Expired")
+
+	// only the new password gets in
+	te.Target("POST", "/login")
+	assertError(t, te.Request([]byte(`{"username":"test_user","password":"12345678"}`)), http.StatusUnauthorized, "Invalid Username or Password")
+	r = te.Request([]byte(`{"username":"test_user","password":"87654321"}`))
+	if assert.NoError(t, r.Err, te.Expect()) {
+
+		assert.Equal(t, http.StatusOK, r.Code, te.Expect())
+		assert.NotNil(t, r.Response.Token, te.Expect())
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	u := prepareTestUser(t)
+	login := database.Login{UserID: u.ID, UserUUID: *u.UUID}
+	if serr := login.CreateLogin(); serr.Err != nil {
+		t.Fatal(serr.Err)
+	}
+	first := login.Token
+
+	// rotated a couple of times, so the first token is well behind
+	for i := 0; i < 2; i++ {
+		if serr := login.RotateLogin(); serr.Err != nil {
+			t.Fatal(serr.Err)
+		}
+	}
+	current := login.Token
+
+	te.Target("POST", "/refresh")
+	assertError(t, te.Request([]byte(`{"refresh_token":"`+first+`"}`)), http.StatusUnauthorized, "Refresh Token Reused")
+
+	// whoever was holding the current token is signed out along with the thief
+	assertError(t, te.Request([]byte(`{"refresh_token":"`+current+`"}`)), http.StatusUnauthorized, "Invalid Refresh Token")
+	if serr := login.GetLogin(); assert.NoError(t, serr.Err) {
+		assert.True(t, login.Revoked)
+	}
+}
@@ -0,0 +1,405 @@
+package routers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IWannaCommunity/gate-jump/src/api/authentication"
+	"github.com/IWannaCommunity/gate-jump/src/api/database"
+	"github.com/IWannaCommunity/gate-jump/src/api/res"
+	"github.com/IWannaCommunity/gate-jump/src/api/settings"
+	"github.com/gorilla/mux"
+)
+
+// how long the browser has to finish a registration or login
+const webAuthnChallengeLifetime = time.Minute * 5
+
+// what a webauthn challenge was handed out for, a challenge only answers the ceremony it's for
+const (
+	webAuthnPurposeRegister = "register"
+	webAuthnPurposeLogin    = "login"
+	webAuthnPurposeMFA      = "mfa"
+)
+
+// CredentialDescriptor points the browser at a credential, as laid out by the webauthn spec
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// CredentialParameter is a key algorithm we'll accept a new credential with
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// CredentialCreationOptions are handed to navigator.credentials.create once the buffers are decoded
+type CredentialCreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// CredentialRequestOptions are handed to navigator.credentials.get once the buffers are decoded
+type CredentialRequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// WebAuthnRegistration is the request expected when finishing a registration
+type WebAuthnRegistration struct {
+	Name       string                             `json:"name"`
+	Credential authentication.PublicKeyCredential `json:"credential"`
+}
+
+// WebAuthnLoginRequest is the request expected on /login/webauthn and its options, the challenge
+// from /login only goes to the options, and makes them for a second factor
+type WebAuthnLoginRequest struct {
+	Challenge  string                              `json:"challenge"`
+	Credential *authentication.PublicKeyCredential `json:"credential"`
+}
+
+func relyingParty() authentication.RelyingParty {
+	return authentication.RelyingParty{ID: settings.WebAuthn.RPID, Name: settings.WebAuthn.RPName, Origin: settings.WebAuthn.Origin}
+}
+
+// the user's credentials as the browser wants them
+func credentialDescriptors(userID int64) ([]CredentialDescriptor, *res.Response) {
+	credentials, serr := database.GetWebAuthnCredentials(userID)
+	if serr.Err != nil {
+		return nil, res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+
+	descriptors := []CredentialDescriptor{}
+	for _, c := range credentials {
+		descriptors = append(descriptors, CredentialDescriptor{Type: "public-key", ID: base64.RawURLEncoding.EncodeToString(c.CredentialID)})
+	}
+	return descriptors, nil
+}
+
+// hands out a challenge for purpose, userID is nil when we don't know who it's for yet
+func newWebAuthnChallenge(userID *int64, purpose string) (string, *res.Response) {
+	challenge, err := authentication.NewWebAuthnChallenge()
+	if err != nil {
+		return "", res.New(http.StatusInternalServerError).SetInternalError(&res.ServerError{Err: err})
+	}
+
+	c := database.WebAuthnChallenge{Challenge: challenge, UserID: userID, Purpose: purpose, Expires: time.Now().Add(webAuthnChallengeLifetime)}
+	if serr := c.CreateWebAuthnChallenge(); serr.Err != nil {
+		return "", res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	return challenge, nil
+}
+
+// checks a login made with a registered credential against a challenge we handed out for purpose,
+// returning the credential so the caller knows whose it is
+func checkAssertion(cred authentication.PublicKeyCredential, purpose string, requireVerified bool) (database.WebAuthnCredential, *res.Response) {
+	var stored database.WebAuthnCredential
+
+	challenge, err := authentication.CredentialChallenge(cred)
+	if err != nil {
+		return stored, res.New(http.StatusBadRequest).SetErrorMessage(err.Error())
+	}
+	c := database.WebAuthnChallenge{Challenge: challenge, Purpose: purpose}
+	if serr := c.ConsumeWebAuthnChallenge(); serr.Err == sql.ErrNoRows {
+		return stored, res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Challenge")
+	} else if serr.Err != nil {
+		return stored, res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+
+	id, err := authentication.DecodeBase64URL(cred.ID)
+	if err != nil {
+		return stored, res.New(http.StatusBadRequest).SetErrorMessage("Malformed Credential")
+	}
+	stored.CredentialID = id
+	if serr := stored.GetWebAuthnCredentialByCredentialID(); serr.Err == sql.ErrNoRows {
+		return stored, res.New(http.StatusUnauthorized).SetErrorMessage("Unknown Credential")
+	} else if serr.Err != nil {
+		return stored, res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	// the challenge was handed out for somebody else's keys
+	if c.UserID != nil && *c.UserID != stored.UserID {
+		return stored, res.New(http.StatusUnauthorized).SetErrorMessage("Unknown Credential")
+	}
+
+	key := authentication.WebAuthnKey{CredentialID: stored.CredentialID, PublicKey: stored.PublicKey, SignCount: stored.SignCount}
+	count, err := relyingParty().VerifyAssertion(cred, challenge, key, requireVerified)
+	if err != nil {
+		return stored, res.New(http.StatusUnauthorized).SetErrorMessage(err.Error())
+	}
+	if serr := stored.UseWebAuthnCredential(count); serr.Err != nil {
+		return stored, res.New(http.StatusInternalServerError).SetInternalError(&serr)
+	}
+	return stored, nil
+}
+
+// start registering a passkey or security key
+func beginWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	u, response := selfOwner(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	if serr := u.GetUser(authentication.USER); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	exclude, response := credentialDescriptors(u.ID)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+	challenge, response := newWebAuthnChallenge(&u.ID, webAuthnPurposeRegister)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	var options CredentialCreationOptions
+	rp := relyingParty()
+	options.Challenge = challenge
+	options.RP.ID = rp.ID
+	options.RP.Name = rp.Name
+	options.User.ID = base64.RawURLEncoding.EncodeToString([]byte(*u.UUID)) // comes back as the userHandle
+	options.User.Name = *u.Name
+	options.User.DisplayName = *u.Name
+	options.PubKeyCredParams = []CredentialParameter{
+		{Type: "public-key", Alg: authentication.COSEAlgES256},
+		{Type: "public-key", Alg: authentication.COSEAlgRS256},
+	}
+	options.Timeout = int64(webAuthnChallengeLifetime / time.Millisecond)
+	options.ExcludeCredentials = exclude
+	options.AuthenticatorSelection.ResidentKey = "preferred" // so it can be used without a username
+	options.AuthenticatorSelection.UserVerification = "preferred"
+	options.Attestation = "none"
+
+	res.New(http.StatusOK).SetWebAuthnOptions(options).JSON(w)
+}
+
+// finish registering a passkey or security key with what the authenticator made
+func finishWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	u, response := selfOwner(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	var wr WebAuthnRegistration
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&wr); err != nil {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	wr.Name = strings.TrimSpace(wr.Name)
+	if wr.Name == "" {
+		wr.Name = "Security Key"
+	}
+	if len(wr.Name) > 64 {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Credential Name").Error(w)
+		return
+	}
+
+	challenge, err := authentication.CredentialChallenge(wr.Credential)
+	if err != nil {
+		res.New(http.StatusBadRequest).SetErrorMessage(err.Error()).Error(w)
+		return
+	}
+	c := database.WebAuthnChallenge{Challenge: challenge, Purpose: webAuthnPurposeRegister}
+	if serr := c.ConsumeWebAuthnChallenge(); serr.Err == sql.ErrNoRows || (serr.Err == nil && *c.UserID != u.ID) {
+		res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Challenge").Error(w)
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	key, err := relyingParty().VerifyRegistration(wr.Credential, challenge, false)
+	if err != nil {
+		res.New(http.StatusBadRequest).SetErrorMessage(err.Error()).Error(w)
+		return
+	}
+
+	credential := database.WebAuthnCredential{CredentialID: key.CredentialID}
+	if serr := credential.GetWebAuthnCredentialByCredentialID(); serr.Err == nil {
+		res.New(http.StatusConflict).SetErrorMessage("Credential Already Registered").Error(w)
+		return
+	} else if serr.Err != sql.ErrNoRows {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	credential = database.WebAuthnCredential{UserID: u.ID, CredentialID: key.CredentialID, PublicKey: key.PublicKey, SignCount: key.SignCount, Name: wr.Name}
+	if serr := credential.CreateWebAuthnCredential(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditTwoFactor, Target: &u.ID, Detail: "added security key " + strconv.FormatInt(credential.ID, 10)})
+
+	res.New(http.StatusCreated).SetCredential(credential).JSON(w)
+}
+
+// list the user's passkeys and security keys
+func getWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	u, response := sessionOwner(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	credentials, serr := database.GetWebAuthnCredentials(u.ID)
+	if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	res.New(http.StatusOK).SetCredentials(credentials).JSON(w)
+}
+
+// remove a passkey or security key, admins can do it for users who lost theirs
+func deleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	u, response := sessionOwner(r)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	vars := mux.Vars(r)
+	cid, err := strconv.Atoi(vars["cid"])
+	if err != nil {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Credential ID").Error(w)
+		return
+	}
+
+	credential := database.WebAuthnCredential{ID: int64(cid)}
+	if serr := credential.GetWebAuthnCredential(); serr.Err == sql.ErrNoRows || (serr.Err == nil && credential.UserID != u.ID) {
+		res.New(http.StatusNotFound).SetErrorMessage("Credential Not Found").Error(w)
+		return
+	} else if serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+
+	if serr := credential.DeleteWebAuthnCredential(); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	audit(r, database.AuditEvent{Type: database.AuditTwoFactor, Target: &u.ID, Detail: "removed security key " + strconv.FormatInt(credential.ID, 10)})
+
+	res.New(http.StatusAccepted).JSON(w)
+}
+
+// start logging in with a passkey. given the challenge from /login it's the second factor
+// for that login instead, and any of the user's keys will do
+func beginWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	var lr WebAuthnLoginRequest
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&lr); err != nil {
+			res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+			return
+		}
+		defer r.Body.Close()
+	}
+
+	options := CredentialRequestOptions{
+		Timeout:          int64(webAuthnChallengeLifetime / time.Millisecond),
+		RPID:             relyingParty().ID,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "required", // the key is all they're giving us, it has to know it's them
+	}
+	var userID *int64
+	purpose := webAuthnPurposeLogin
+
+	if lr.Challenge != "" {
+		mfa := database.MFAChallenge{Challenge: lr.Challenge}
+		if serr := mfa.GetMFAChallenge(); serr.Err == sql.ErrNoRows {
+			res.New(http.StatusUnauthorized).SetErrorMessage("Invalid Challenge").Error(w)
+			return
+		} else if serr.Err != nil {
+			res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+			return
+		}
+
+		allow, response := credentialDescriptors(mfa.UserID)
+		if response != nil {
+			response.Error(w)
+			return
+		}
+		options.AllowCredentials = allow
+		options.UserVerification = "discouraged" // they already gave their password
+		userID = &mfa.UserID
+		purpose = webAuthnPurposeMFA
+	}
+
+	challenge, response := newWebAuthnChallenge(userID, purpose)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+	options.Challenge = challenge
+
+	res.New(http.StatusOK).SetWebAuthnOptions(options).JSON(w)
+}
+
+// log in with a passkey alone, it stands in for the password and any second factor
+func finishWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	var lr WebAuthnLoginRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&lr); err != nil || lr.Credential == nil {
+		res.New(http.StatusBadRequest).SetErrorMessage("Invalid Request Payload").Error(w)
+		return
+	}
+	defer r.Body.Close()
+
+	stored, response := checkAssertion(*lr.Credential, webAuthnPurposeLogin, true)
+	if response != nil {
+		response.Error(w)
+		return
+	}
+
+	u := database.User{ID: stored.UserID}
+	if serr := u.GetUser(authentication.SERVER); serr.Err != nil {
+		res.New(http.StatusInternalServerError).SetInternalError(&serr).Error(w)
+		return
+	}
+	// discoverable credentials say whose they are, it has to be who we have them down for
+	if handle := lr.Credential.Response.UserHandle; handle != "" {
+		if owner, err := authentication.DecodeBase64URL(handle); err != nil || string(owner) != *u.UUID {
+			res.New(http.StatusUnauthorized).SetErrorMessage("Unknown Credential").Error(w)
+			return
+		}
+	}
+	if response := checkBan(r, &u); response != nil {
+		response.Error(w)
+		return
+	}
+
+	completeLogin(w, r, u)
+}
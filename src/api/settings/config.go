@@ -2,9 +2,14 @@ package settings
 
 import (
 	"encoding/json"
+	"net"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/IWannaCommunity/gate-jump/src/api/log"
+	"github.com/IWannaCommunity/gate-jump/src/api/util"
 )
 
 // DatabaseConfig database configuration information (maybe not needed)
@@ -31,18 +36,43 @@ type superuserConfig struct {
 	Password string `json:"password"`
 }
 
+// who we are to passkeys, credentials only work on the RPID's domain and from pages on Origin
+type webAuthnConfig struct {
+	RPID   string `json:"rpId"`
+	RPName string `json:"rpName"`
+	Origin string `json:"origin"`
+}
+
+// how many requests a client can make to a route in a period
+type rateLimitConfig struct {
+	Requests int
+	Per      time.Duration
+}
+
+// token signing keys, they get replaced every Rotation
+type keysConfig struct {
+	Algorithm string        `json:"algorithm"`
+	Rotation  time.Duration `json:"rotationDays"`
+}
+
 // Configuration and Settings
 var (
 	Database          databaseConfig
 	Https             httpsConfig
 	Mailer            mailerConfig
 	SuperUser         superuserConfig
+	Keys              keysConfig
+	WebAuthn          webAuthnConfig
+	RateLimits        map[string]rateLimitConfig // by path prefix, "default" for routes without their own
+	TrustedProxies    []*net.IPNet
+	DeletionRetention time.Duration // how long a deleted account can be restored before it's erased
 	RouteBase         string
 	Port              string
 	SslPort           string
 	Host              string
 	Protocol          string
-	JwtSecret         string
+	WebUI             string
+	Issuer            string
 	DiscordWebhookURL string
 	Major             int
 	Patch             int
@@ -92,7 +122,97 @@ func setActiveConfig(configmap map[string]interface{}) {
 		Password: configmap["superuser"].(map[string]interface{})["password"].(string),
 	}
 
+	// optional, defaults to ES256 keys that last a month
+	Keys = keysConfig{Algorithm: "ES256", Rotation: time.Hour * 24 * 30}
+	if keys, ok := configmap["keys"].(map[string]interface{}); ok {
+		if algorithm, ok := keys["algorithm"].(string); ok {
+			Keys.Algorithm = algorithm
+		}
+		if days, ok := keys["rotationDays"].(float64); ok && days > 0 {
+			Keys.Rotation = time.Duration(days * float64(time.Hour*24))
+		}
+	}
+
 	Host = configmap["host"].(string)
 	Port = configmap["port"].(string)
 	SslPort = configmap["sslPort"].(string)
+
+	// optional, the public url of the service that goes into tokens and the openid configuration
+	if issuer, ok := configmap["issuer"].(string); ok {
+		Issuer = strings.TrimRight(issuer, "/")
+	} else if Https.CertFile != "" && Https.KeyFile != "" {
+		Issuer = "https://" + Host + ":" + SslPort
+	} else {
+		Issuer = "http://" + Host + ":" + Port
+	}
+
+	// optional, where the web interface lives for flows that need a human in the loop
+	WebUI = "/"
+	if webui, ok := configmap["webui"].(string); ok {
+		WebUI = webui
+	}
+
+	// optional, passkeys are made on the web interface so they default to wherever it lives
+	origin := Issuer
+	if u, err := url.Parse(WebUI); err == nil && u.Host != "" {
+		origin = u.Scheme + "://" + u.Host
+	}
+	WebAuthn = webAuthnConfig{RPName: "gate-jump", Origin: origin}
+	if u, err := url.Parse(origin); err == nil {
+		WebAuthn.RPID = u.Hostname()
+	}
+	if webauthn, ok := configmap["webauthn"].(map[string]interface{}); ok {
+		if rpID, ok := webauthn["rpId"].(string); ok {
+			WebAuthn.RPID = rpID
+		}
+		if rpName, ok := webauthn["rpName"].(string); ok {
+			WebAuthn.RPName = rpName
+		}
+		if origin, ok := webauthn["origin"].(string); ok {
+			WebAuthn.Origin = strings.TrimRight(origin, "/")
+		}
+	}
+
+	// optional, the routes people would want to hammer are held to less than the rest
+	RateLimits = map[string]rateLimitConfig{
+		"default":   {Requests: 300, Per: time.Minute},
+		"/register": {Requests: 10, Per: time.Hour},
+		"/login":    {Requests: 30, Per: time.Minute},
+		"/verify":   {Requests: 10, Per: time.Minute},
+		"/password": {Requests: 10, Per: time.Hour},
+	}
+	if limits, ok := configmap["rateLimits"].(map[string]interface{}); ok {
+		for route, limit := range limits {
+			limit, _ := limit.(map[string]interface{})
+			requests, _ := limit["requests"].(float64)
+			seconds, _ := limit["seconds"].(float64)
+			if requests < 1 || seconds <= 0 {
+				log.Warning("Ignoring the rate limit for " + route + ", it needs requests and seconds")
+				continue
+			}
+			RateLimits[route] = rateLimitConfig{Requests: int(requests), Per: time.Duration(seconds * float64(time.Second))}
+		}
+	}
+
+	// optional, the proxies we sit behind, the address they say they forwarded for is the client's
+	TrustedProxies = nil
+	if proxies, ok := configmap["trustedProxies"].([]interface{}); ok {
+		var list []string
+		for _, proxy := range proxies {
+			if proxy, ok := proxy.(string); ok {
+				list = append(list, proxy)
+			}
+		}
+		trusted, err := util.ParseTrustedProxies(list)
+		if err != nil {
+			log.Fatal("Failed reading trustedProxies: ", err)
+		}
+		TrustedProxies = trusted
+	}
+
+	// optional, deleted accounts are kept for a month in case the owner changes their mind
+	DeletionRetention = time.Hour * 24 * 30
+	if days, ok := configmap["deletionRetentionDays"].(float64); ok && days >= 0 {
+		DeletionRetention = time.Duration(days * float64(time.Hour*24))
+	}
 }
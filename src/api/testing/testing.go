@@ -8,6 +8,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 
 	"github.com/IWannaCommunity/gate-jump/src/api/database"
 	"github.com/IWannaCommunity/gate-jump/src/api/log"
@@ -21,6 +23,7 @@ type Response struct {
 	Token    *string     `json:"token,omitempty"`
 	User     interface{} `json:"user,omitempty"`
 	UserList interface{} `json:"userList,omitempty"`
+	Redirect *string     `json:"redirect,omitempty"`
 }
 
 // test payload containing information about the request. should include response time
@@ -37,6 +40,7 @@ type TestingEnv struct {
 	lastRequest interface{}
 	method      string
 	url         string
+	token       string
 }
 
 func (te *TestingEnv) ExpectedPayload(code int, err error, token string, user interface{}, userList interface{}) {
@@ -53,6 +57,9 @@ func (te *TestingEnv) Prepare(method string, url string) {
 	// clean database for new setup
 	clearTable(te.s)
 
+	// tokens from before don't belong to anybody anymore
+	te.token = ""
+
 	// set method and url for api requests
 	if method != "" {
 		te.method = method
@@ -62,6 +69,17 @@ func (te *TestingEnv) Prepare(method string, url string) {
 	}
 }
 
+// Target changes where requests go without clearing the database, for following on from earlier requests
+func (te *TestingEnv) Target(method string, url string) {
+	te.method = method
+	te.url = url
+}
+
+// Authorize sends the token as a bearer token with the requests that follow, empty stops sending one
+func (te *TestingEnv) Authorize(token string) {
+	te.token = token
+}
+
 func clearTable(db *sql.DB) {
 	var err error
 	_, err = db.Exec("DROP DATABASE gatejump")
@@ -89,6 +107,21 @@ func (te *TestingEnv) Request(jsonRequest []byte) TestPayload {
 	// Make API Request
 	te.lastRequest = jsonRequest
 	httpRequest, _ := http.NewRequest(te.method, te.url, bytes.NewBuffer(jsonRequest))
+	return te.serve(httpRequest)
+}
+
+// RequestForm makes the request with a form body, like the oauth endpoints expect
+func (te *TestingEnv) RequestForm(form url.Values) TestPayload {
+	te.lastRequest = form.Encode()
+	httpRequest, _ := http.NewRequest(te.method, te.url, strings.NewReader(form.Encode()))
+	httpRequest.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return te.serve(httpRequest)
+}
+
+func (te *TestingEnv) serve(httpRequest *http.Request) TestPayload {
+	if te.token != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+te.token)
+	}
 	httpTestRecorder := httptest.NewRecorder()
 	te.r.ServeHTTP(httpTestRecorder, httpRequest)
 	tp := TestPayload{}
@@ -0,0 +1,105 @@
+package util
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseTrustedProxies reads a list of CIDRs, a bare address is taken as just that address
+func ParseTrustedProxies(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range list {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: entry}
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				nets = append(nets, &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)})
+			} else {
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+			}
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// ClientIP finds the address of whoever made the request. the forwarding headers can be made up
+// by anybody, so they're only believed as far back as the chain of trusted proxies goes
+func ClientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	ip := parseHop(r.RemoteAddr)
+	if ip == nil || !isTrusted(ip, trusted) {
+		return ip
+	}
+
+	// each proxy adds who it heard from to the end, so walk back from the end until someone we
+	// don't trust shows up, they're the client
+	hops := forwardedFor(r)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHop(hops[i])
+		if hop == nil { // a proxy we trust wouldn't write garbage, so it came from before them
+			break
+		}
+		ip = hop
+		if !isTrusted(ip, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	for _, ipnet := range trusted {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// the addresses from Forwarded, or from X-Forwarded-For if there isn't one, in the order they
+// were added
+func forwardedFor(r *http.Request) []string {
+	var hops []string
+	if headers := r.Header["Forwarded"]; len(headers) > 0 {
+		for _, header := range headers {
+			for _, element := range strings.Split(header, ",") {
+				for _, pair := range strings.Split(element, ";") {
+					pair = strings.TrimSpace(pair)
+					if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+						hops = append(hops, pair[4:])
+					}
+				}
+			}
+		}
+		return hops
+	}
+
+	for _, header := range r.Header["X-Forwarded-For"] {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// reads an address the way proxies write them, with or without a port, brackets or quotes, and
+// normalizes v4 addresses to 4 bytes
+func parseHop(hop string) net.IP {
+	hop = strings.Trim(strings.TrimSpace(hop), `"`)
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	nets, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if assert.NoError(t, err) && assert.Len(t, nets, 3) {
+		assert.True(t, nets[0].Contains(net.ParseIP("10.1.2.3")))
+		assert.True(t, nets[1].Contains(net.ParseIP("192.0.2.1")))
+		assert.False(t, nets[1].Contains(net.ParseIP("192.0.2.2")))
+		assert.True(t, nets[2].Contains(net.ParseIP("2001:db8::1")))
+	}
+
+	_, err = ParseTrustedProxies([]string{"not an address"})
+	assert.Error(t, err)
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/99"})
+	assert.Error(t, err)
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, _ := ParseTrustedProxies([]string{"10.0.0.0/8", "2001:db8::1"})
+
+	request := func(remote string, headers map[string]string) net.IP {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remote
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		return ClientIP(r, trusted)
+	}
+
+	// the port is dropped and v4 addresses come out as 4 bytes
+	assert.Equal(t, net.ParseIP("198.51.100.7").To4(), request("198.51.100.7:5000", nil))
+	assert.Equal(t, net.ParseIP("2001:db8::7"), request("[2001:db8::7]:5000", nil))
+	assert.Equal(t, net.IPv4len, len(request("[::ffff:198.51.100.7]:5000", nil)))
+
+	// anybody can send the headers, only a trusted proxy is believed
+	assert.Equal(t, net.ParseIP("198.51.100.7").To4(), request("198.51.100.7:5000", map[string]string{"X-Forwarded-For": "203.0.113.1"}))
+	assert.Equal(t, net.ParseIP("203.0.113.1").To4(), request("10.0.0.1:5000", map[string]string{"X-Forwarded-For": "203.0.113.1"}))
+
+	// a client making up hops before the real one doesn't get anywhere
+	assert.Equal(t, net.ParseIP("203.0.113.1").To4(), request("10.0.0.1:5000", map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.1, 10.0.0.2"}))
+
+	// Forwarded wins over X-Forwarded-For, with its ports, brackets and quotes
+	assert.Equal(t, net.ParseIP("2001:db8:cafe::17"), request("[2001:db8::1]:443", map[string]string{
+		"Forwarded":       `for=192.0.2.60;proto=http, For="[2001:db8:cafe::17]:4711"`,
+		"X-Forwarded-For": "203.0.113.1",
+	}))
+
+	// garbage from the proxy's side means the proxy is the last thing we know about
+	assert.Equal(t, net.ParseIP("10.0.0.1").To4(), request("10.0.0.1:5000", map[string]string{"X-Forwarded-For": "unknown"}))
+
+	// every hop being one of ours means the request started inside
+	assert.Equal(t, net.ParseIP("10.0.0.3").To4(), request("10.0.0.1:5000", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}))
+}
@@ -2,6 +2,8 @@ package util
 
 import (
 	srand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"math/rand"
 )
 
@@ -44,3 +46,34 @@ func CreateRandomString(n int, letterSet uint8, token chan []byte, err chan erro
 	token <- b
 
 }
+
+// CreateSecureString returns a random string of n characters drawn straight
+// from crypto/rand, for anything that ends up acting as a credential.
+func CreateSecureString(n int) (string, error) {
+	letters := letterBytes[2][:62] // alphanumerics only, these end up in urls
+	max := byte(256 - 256%len(letters))
+
+	b := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(b) < n {
+		if _, err := srand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, c := range buf {
+			// throw away anything that would bias the modulo below
+			if c >= max || len(b) == n {
+				continue
+			}
+			b = append(b, letters[int(c)%len(letters)])
+		}
+	}
+
+	return string(b), nil
+}
+
+// HashToken returns the hex encoded SHA-256 of a token, this is what gets
+// stored in the database so a leaked table can't be replayed.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"net/url"
 	"reflect"
 	"regexp"
 	"runtime"
@@ -69,3 +70,33 @@ func IsValidEmail(s string) bool { // http://www.golangprograms.com/regular-expr
 	re := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 	return re.MatchString(s)
 }
+
+// IsValidRedirectURI checks an oauth redirect uri is absolute, has no fragment, and is only
+// plain http when it points back at the local machine (RFC 8252 native apps)
+func IsValidRedirectURI(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" || len(s) > 256 {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return false
+}
+
+// IsValidScopeName checks a scope name can be put in a space separated scope list (RFC 6749 scope-token)
+func IsValidScopeName(s string) bool {
+	if len(s) == 0 || len(s) > 255 {
+		return false
+	}
+	for _, c := range s {
+		if c < 0x21 || c > 0x7e || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,14 @@
+CREATE TABLE authcodes (
+    id INT NOT NULL AUTO_INCREMENT,
+    code CHAR(64) NOT NULL UNIQUE,
+    appid INT(8) NOT NULL,
+    userid INT NOT NULL,
+    redirect_uri VARCHAR(256) NOT NULL,
+    scope TEXT,
+    challenge VARCHAR(128),
+    challenge_method VARCHAR(8),
+    expires DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (appid) REFERENCES applications(id),
+    FOREIGN KEY (userid) REFERENCES users(id)
+)
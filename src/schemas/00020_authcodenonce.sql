@@ -0,0 +1,2 @@
+ALTER TABLE authcodes
+    ADD nonce VARCHAR(256)
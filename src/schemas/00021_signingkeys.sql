@@ -0,0 +1,9 @@
+CREATE TABLE signing_keys (
+    kid VARCHAR(64) NOT NULL,
+    algorithm VARCHAR(8) NOT NULL,
+    private_key TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    retires DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    PRIMARY KEY (kid)
+)
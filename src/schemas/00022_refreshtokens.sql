@@ -0,0 +1,11 @@
+ALTER TABLE logins
+    MODIFY token CHAR(64) NOT NULL UNIQUE,
+    MODIFY ipaddrv4 BINARY(4),
+    ADD previous CHAR(64),
+    ADD created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD expires DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD revoked BOOL NOT NULL DEFAULT FALSE,
+    ADD appid INT(8),
+    ADD scope TEXT,
+    ADD INDEX (previous),
+    ADD FOREIGN KEY (appid) REFERENCES applications(id)
@@ -0,0 +1,2 @@
+ALTER TABLE logins
+    ADD user_agent VARCHAR(512)
@@ -0,0 +1,9 @@
+CREATE TABLE tokens (
+    jti CHAR(32) NOT NULL,
+    userid INT NOT NULL,
+    expires DATETIME NOT NULL,
+    revoked BOOL NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (jti),
+    INDEX (userid, expires),
+    FOREIGN KEY (userid) REFERENCES users(id)
+)
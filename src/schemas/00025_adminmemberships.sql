@@ -0,0 +1,5 @@
+INSERT INTO memberships (userid, groupid)
+SELECT users.id, `groups`.id FROM users JOIN `groups` ON `groups`.name = 'passport'
+WHERE users.admin = TRUE AND NOT EXISTS (
+    SELECT 1 FROM memberships WHERE memberships.userid = users.id AND memberships.groupid = `groups`.id
+)
@@ -0,0 +1 @@
+ALTER TABLE scopes ADD UNIQUE INDEX scopes_name (name)
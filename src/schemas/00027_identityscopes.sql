@@ -0,0 +1,4 @@
+INSERT IGNORE INTO scopes (name, description)
+VALUES ('openid', 'Sign you in with your account.'),
+    ('profile', 'See your username and locale.'),
+    ('email', 'See your email address and whether it is verified.')
@@ -0,0 +1,12 @@
+CREATE TABLE grants (
+    id INT NOT NULL AUTO_INCREMENT,
+    userid INT NOT NULL,
+    appid INT(8) NOT NULL,
+    scope TEXT NOT NULL,
+    created DATETIME NOT NULL,
+    updated DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE INDEX grants_user_app (userid, appid),
+    FOREIGN KEY (userid) REFERENCES users(id),
+    FOREIGN KEY (appid) REFERENCES applications(id)
+)
@@ -0,0 +1,7 @@
+CREATE TABLE application_scopes (
+    appid INT(8) NOT NULL,
+    scopeid INT NOT NULL,
+    PRIMARY KEY (appid, scopeid),
+    FOREIGN KEY (appid) REFERENCES applications(id),
+    FOREIGN KEY (scopeid) REFERENCES scopes(id)
+)
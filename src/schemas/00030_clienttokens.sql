@@ -0,0 +1,4 @@
+ALTER TABLE tokens
+    MODIFY userid INT NULL,
+    ADD appid INT(8) NULL AFTER userid,
+    ADD INDEX (appid, expires)
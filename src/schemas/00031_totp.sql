@@ -0,0 +1,9 @@
+CREATE TABLE totp (
+    userid INT NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    confirmed BOOL NOT NULL DEFAULT FALSE,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (userid),
+    FOREIGN KEY (userid) REFERENCES users(id)
+)
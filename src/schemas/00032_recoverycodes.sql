@@ -0,0 +1,8 @@
+CREATE TABLE recoverycodes (
+    id INT NOT NULL AUTO_INCREMENT,
+    userid INT NOT NULL,
+    code CHAR(64) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE INDEX recoverycodes_user_code (userid, code),
+    FOREIGN KEY (userid) REFERENCES users(id)
+)
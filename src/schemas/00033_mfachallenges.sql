@@ -0,0 +1,9 @@
+CREATE TABLE mfachallenges (
+    id INT NOT NULL AUTO_INCREMENT,
+    challenge CHAR(64) NOT NULL UNIQUE,
+    userid INT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (userid) REFERENCES users(id)
+)
@@ -0,0 +1,12 @@
+CREATE TABLE webauthncredentials (
+    id INT NOT NULL AUTO_INCREMENT,
+    userid INT NOT NULL,
+    credential_id VARBINARY(255) NOT NULL UNIQUE,
+    public_key BLOB NOT NULL,
+    sign_count INT UNSIGNED NOT NULL DEFAULT 0,
+    name VARCHAR(64) NOT NULL,
+    created DATETIME NOT NULL,
+    last_used DATETIME,
+    PRIMARY KEY (id),
+    FOREIGN KEY (userid) REFERENCES users(id)
+)
@@ -0,0 +1,9 @@
+CREATE TABLE webauthnchallenges (
+    id INT NOT NULL AUTO_INCREMENT,
+    challenge CHAR(64) NOT NULL UNIQUE,
+    userid INT,
+    purpose VARCHAR(16) NOT NULL,
+    expires DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (userid) REFERENCES users(id)
+)
@@ -0,0 +1,3 @@
+ALTER TABLE magic
+    ADD COLUMN purpose VARCHAR(16) NOT NULL DEFAULT 'verify',
+    ADD COLUMN expires_at DATETIME
@@ -0,0 +1,3 @@
+UPDATE magic SET
+    magic = SHA2(magic, 256),
+    expires_at = COALESCE(expires_at, NOW() + INTERVAL 7 DAY)
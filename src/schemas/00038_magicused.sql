@@ -0,0 +1,5 @@
+ALTER TABLE magic
+    MODIFY COLUMN magic CHAR(64) NOT NULL,
+    MODIFY COLUMN expires_at DATETIME NOT NULL,
+    ADD COLUMN used_at DATETIME,
+    ADD UNIQUE INDEX magic_hash (magic)
@@ -0,0 +1,4 @@
+ALTER TABLE magic
+    ADD COLUMN email VARCHAR(100),
+    ADD COLUMN created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ADD INDEX magic_sent (purpose, created)
@@ -0,0 +1,15 @@
+CREATE TABLE audit_events (
+    id BIGINT NOT NULL AUTO_INCREMENT,
+    type VARCHAR(32) NOT NULL,
+    actor INT,
+    client VARCHAR(64),
+    target INT,
+    ipaddrv4 BINARY(4),
+    ipaddrv6 BINARY(16),
+    detail TEXT,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    INDEX audit_actor (actor, created),
+    INDEX audit_target (target, created),
+    INDEX audit_type (type, created)
+)
@@ -0,0 +1,14 @@
+CREATE TABLE bans (
+    id INT NOT NULL AUTO_INCREMENT,
+    userid INT NOT NULL,
+    reason VARCHAR(500) NOT NULL,
+    banned_by INT,
+    created DATETIME NOT NULL,
+    expires DATETIME,
+    lifted DATETIME,
+    lifted_by INT,
+    PRIMARY KEY (id),
+    INDEX ban_user (userid, lifted),
+    INDEX ban_expires (lifted, expires),
+    FOREIGN KEY (userid) REFERENCES users(id)
+)
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN purge_warned DATETIME,
+    ADD COLUMN purged DATETIME,
+    ADD INDEX users_deleted (deleted, date_deleted)
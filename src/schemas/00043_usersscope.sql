@@ -0,0 +1,2 @@
+INSERT IGNORE INTO scopes (name, description)
+VALUES ('users', 'Lets an application acting as itself look up, update, and delete users, like an admin would.');
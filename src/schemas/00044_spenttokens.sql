@@ -0,0 +1,7 @@
+CREATE TABLE spenttokens (
+    token CHAR(64) NOT NULL,
+    loginid INT NOT NULL,
+    spent DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (token),
+    FOREIGN KEY (loginid) REFERENCES logins(id) ON DELETE CASCADE
+)
@@ -0,0 +1,2 @@
+INSERT IGNORE INTO spenttokens (token, loginid)
+SELECT previous, id FROM logins WHERE previous IS NOT NULL
@@ -0,0 +1,2 @@
+ALTER TABLE logins
+    DROP COLUMN previous
@@ -1,11 +1,31 @@
 import React, { Component } from "react";
 import Test from './test.jsx';
 import Navigation from './navigation.jsx';
+import Consent from './consent.jsx';
+import Reset from './reset.jsx';
 
 import '../styles/App.css';
 
 class App extends Component {
     render() {
+        // the api sends users here when an application wants them to sign in
+        if (window.location.pathname === "/authorize") {
+            return (
+                <div>
+                    <Navigation/>
+                    <Consent/>
+                </div>
+            );
+        }
+        // password reset emails link here
+        if (window.location.pathname.indexOf("/reset/") === 0) {
+            return (
+                <div>
+                    <Navigation/>
+                    <Reset/>
+                </div>
+            );
+        }
         return (
             <div>
                 <Navigation/>
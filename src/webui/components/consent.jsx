@@ -0,0 +1,247 @@
+import React, {Component} from 'react';
+import { Button, FormGroup, ControlLabel, FormControl, ListGroup, ListGroupItem, Panel, Alert } from 'react-bootstrap';
+
+// the api is reached on the same origin, the dev server proxies it (see webpack.config.js)
+const authorizeURL = "/oauth/authorize";
+const loginURL = "/login";
+const mfaURL = "/login/mfa";
+const passkeyURL = "/login/webauthn";
+
+// the api sends buffers as base64url, the browser wants them as ArrayBuffers
+function fromBase64URL(value) {
+    const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+    return Uint8Array.from(atob(base64), c => c.charCodeAt(0)).buffer;
+}
+
+function toBase64URL(buffer) {
+    const binary = String.fromCharCode.apply(null, new Uint8Array(buffer));
+    return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+// asks the browser for a passkey answering the request options the api handed out
+function getPasskey(options) {
+    const publicKey = Object.assign({}, options, {
+        challenge: fromBase64URL(options.challenge),
+        allowCredentials: (options.allowCredentials || []).map(c => Object.assign({}, c, {id: fromBase64URL(c.id)})),
+    });
+    return navigator.credentials.get({publicKey: publicKey}).then(credential => ({
+        id: credential.id,
+        type: credential.type,
+        response: {
+            clientDataJSON: toBase64URL(credential.response.clientDataJSON),
+            authenticatorData: toBase64URL(credential.response.authenticatorData),
+            signature: toBase64URL(credential.response.signature),
+            userHandle: credential.response.userHandle ? toBase64URL(credential.response.userHandle) : "",
+        },
+    }));
+}
+
+// Consent is the page /oauth/authorize sends users to, it signs them in if they need to be and
+// asks them if the application can have the scopes it asked for
+class Consent extends Component {
+    constructor(props) {
+        super(props);
+        this.state = {
+            token: window.localStorage.getItem("token"),
+            username: "",
+            password: "",
+            challenge: null,
+            methods: [],
+            code: "",
+            application: null,
+            scopes: [],
+            error: null,
+            loading: true,
+        };
+    this.onChange = this.onChange.bind(this);
+    this.onLogin = this.onLogin.bind(this);
+    this.onCode = this.onCode.bind(this);
+    this.onPasskey = this.onPasskey.bind(this);
+    this.onApprove = this.onApprove.bind(this);
+    this.onDeny = this.onDeny.bind(this);
+    }
+
+    componentDidMount() {
+        if (this.state.token) {
+            this.authorize("");
+        } else {
+            this.setState({loading: false});
+        }
+    }
+
+    onChange(event) {
+        this.setState({[event.target.name]: event.target.value});
+    }
+
+    // sends the authorization request along with our answer, if the api hands back a redirect
+    // we're done, otherwise it wants the user to consent first
+    authorize(consent) {
+        const body = new URLSearchParams(window.location.search);
+        if (consent) {
+            body.set("consent", consent);
+        }
+
+        this.setState({loading: true, error: null});
+        fetch(authorizeURL, {
+            method: "POST",
+            headers: {"Authorization": "Bearer " + this.state.token},
+            body: body,
+        })
+        .then(response => response.json().then(payload => ({status: response.status, payload: payload})))
+        .then(({status, payload}) => {
+            if (status === 401) { // token expired, sign in again
+                window.localStorage.removeItem("token");
+                this.setState({token: null, loading: false});
+            } else if (!payload.success) {
+                this.setState({error: payload.error, loading: false});
+            } else if (payload.redirect) {
+                window.location.assign(payload.redirect);
+            } else {
+                const scopes = payload.scopeList && payload.scopeList.scopes ? payload.scopeList.scopes : [];
+                this.setState({application: payload.application, scopes: scopes, loading: false});
+            }
+        })
+        .catch(() => this.setState({error: "Could not reach the server", loading: false}));
+    }
+
+    // signs in on url with body, users with two factor get a challenge to answer with a code first
+    login(url, body) {
+        this.setState({loading: true, error: null});
+        fetch(url, {
+            method: "POST",
+            headers: {"Content-Type": "application/json"},
+            body: JSON.stringify(body),
+        })
+        .then(response => response.json())
+        .then(payload => {
+            if (!payload.success) {
+                this.setState({error: payload.error, loading: false});
+                return;
+            }
+            if (payload.mfa_required) {
+                this.setState({challenge: payload.challenge, methods: payload.mfa_methods || [], password: "", loading: false});
+                return;
+            }
+            window.localStorage.setItem("token", payload.token);
+            this.setState({token: payload.token, password: "", challenge: null, code: ""}, () => this.authorize(""));
+        })
+        .catch(() => this.setState({error: "Could not reach the server", loading: false}));
+    }
+
+    onLogin(event) {
+        event.preventDefault();
+        this.login(loginURL, {username: this.state.username, password: this.state.password});
+    }
+
+    onCode(event) {
+        event.preventDefault();
+        this.login(mfaURL, {challenge: this.state.challenge, code: this.state.code});
+    }
+
+    // with a challenge from /login the passkey is the second factor, without one it's the whole login
+    onPasskey() {
+        const challenge = this.state.challenge;
+        this.setState({loading: true, error: null});
+        fetch(passkeyURL + "/options", {
+            method: "POST",
+            headers: {"Content-Type": "application/json"},
+            body: challenge ? JSON.stringify({challenge: challenge}) : "",
+        })
+        .then(response => response.json())
+        .then(payload => {
+            if (!payload.success) {
+                throw new Error(payload.error);
+            }
+            return getPasskey(payload.publicKey);
+        })
+        .then(credential => {
+            if (challenge) {
+                this.login(mfaURL, {challenge: challenge, credential: credential});
+            } else {
+                this.login(passkeyURL, {credential: credential});
+            }
+        })
+        .catch(err => this.setState({error: err.message || "Could not use the passkey", loading: false}));
+    }
+
+    onApprove() {
+        this.authorize("approve");
+    }
+
+    onDeny() {
+        this.authorize("deny");
+    }
+
+    render() {
+        const error = this.state.error ? <Alert bsStyle="danger">{this.state.error}</Alert> : null;
+
+        if (!this.state.token && this.state.challenge) {
+            return (
+                <Panel>
+                    <Panel.Heading>Confirm it's you</Panel.Heading>
+                    <Panel.Body>
+                        {error}
+                        <form onSubmit={this.onCode}>
+                            <FormGroup>
+                                <ControlLabel>Code</ControlLabel>
+                                <FormControl name="code" type="text" autoComplete="one-time-code" value={this.state.code} onChange={this.onChange}/>
+                            </FormGroup>
+                            <Button type="submit" bsStyle="primary" disabled={this.state.loading}>Verify</Button>
+                            {" "}
+                            {this.state.methods.indexOf("webauthn") >= 0 &&
+                                <Button onClick={this.onPasskey} disabled={this.state.loading}>Use a Security Key</Button>}
+                        </form>
+                    </Panel.Body>
+                </Panel>
+            );
+        }
+
+        if (!this.state.token) {
+            return (
+                <Panel>
+                    <Panel.Heading>Sign in to continue</Panel.Heading>
+                    <Panel.Body>
+                        {error}
+                        <form onSubmit={this.onLogin}>
+                            <FormGroup>
+                                <ControlLabel>Username</ControlLabel>
+                                <FormControl name="username" type="text" value={this.state.username} onChange={this.onChange}/>
+                            </FormGroup>
+                            <FormGroup>
+                                <ControlLabel>Password</ControlLabel>
+                                <FormControl name="password" type="password" value={this.state.password} onChange={this.onChange}/>
+                            </FormGroup>
+                            <Button type="submit" bsStyle="primary" disabled={this.state.loading}>Sign In</Button>
+                            {" "}
+                            <Button onClick={this.onPasskey} disabled={this.state.loading}>Sign In with a Passkey</Button>
+                        </form>
+                    </Panel.Body>
+                </Panel>
+            );
+        }
+
+        if (!this.state.application) {
+            return error || <div>Loading...</div>;
+        }
+
+        return (
+            <Panel>
+                <Panel.Heading>{this.state.application.name} would like to</Panel.Heading>
+                <Panel.Body>
+                    {error}
+                    <p>{this.state.application.description}</p>
+                    <ListGroup>
+                        {this.state.scopes.map(scope =>
+                            <ListGroupItem key={scope.id} header={scope.name}>{scope.description}</ListGroupItem>
+                        )}
+                    </ListGroup>
+                    <Button bsStyle="primary" onClick={this.onApprove} disabled={this.state.loading}>Allow</Button>
+                    {" "}
+                    <Button onClick={this.onDeny} disabled={this.state.loading}>Deny</Button>
+                </Panel.Body>
+            </Panel>
+        );
+    }
+}
+
+export default Consent;
@@ -0,0 +1,81 @@
+import React, {Component} from 'react';
+import { Button, FormGroup, ControlLabel, FormControl, Panel, Alert } from 'react-bootstrap';
+
+// the api is reached on the same origin, the dev server proxies it (see webpack.config.js)
+const resetURL = "/password/reset/";
+
+// Reset is the page password reset emails link to, the magic is the last part of the path
+class Reset extends Component {
+    constructor(props) {
+        super(props);
+        this.state = {
+            magic: window.location.pathname.split("/").pop(),
+            password: "",
+            confirm: "",
+            error: null,
+            done: false,
+            loading: false,
+        };
+    this.onChange = this.onChange.bind(this);
+    this.onReset = this.onReset.bind(this);
+    }
+
+    onChange(event) {
+        this.setState({[event.target.name]: event.target.value});
+    }
+
+    onReset(event) {
+        event.preventDefault();
+        if (this.state.password !== this.state.confirm) {
+            this.setState({error: "Passwords Do Not Match"});
+            return;
+        }
+
+        this.setState({loading: true, error: null});
+        fetch(resetURL + this.state.magic, {
+            method: "POST",
+            headers: {"Content-Type": "application/json"},
+            body: JSON.stringify({password: this.state.password}),
+        })
+        .then(response => response.json())
+        .then(payload => {
+            if (!payload.success) {
+                this.setState({error: payload.error, loading: false});
+                return;
+            }
+            // every session was revoked, including any we had
+            window.localStorage.removeItem("token");
+            this.setState({done: true, password: "", confirm: "", loading: false});
+        })
+        .catch(() => this.setState({error: "Could not reach the server", loading: false}));
+    }
+
+    render() {
+        if (this.state.done) {
+            return <Alert bsStyle="success">Your password was changed, you can sign in with it now.</Alert>;
+        }
+
+        const error = this.state.error ? <Alert bsStyle="danger">{this.state.error}</Alert> : null;
+        return (
+            <Panel>
+                <Panel.Heading>Choose a new password</Panel.Heading>
+                <Panel.Body>
+                    {error}
+                    <form onSubmit={this.onReset}>
+                        <FormGroup>
+                            <ControlLabel>New Password</ControlLabel>
+                            <FormControl name="password" type="password" autoComplete="new-password" value={this.state.password} onChange={this.onChange}/>
+                        </FormGroup>
+                        <FormGroup>
+                            <ControlLabel>Confirm Password</ControlLabel>
+                            <FormControl name="confirm" type="password" autoComplete="new-password" value={this.state.confirm} onChange={this.onChange}/>
+                        </FormGroup>
+                        <Button type="submit" bsStyle="primary" disabled={this.state.loading}>Reset Password</Button>
+                    </form>
+                </Panel.Body>
+            </Panel>
+        );
+    }
+}
+
+export default Reset;
@@ -9,7 +9,13 @@ module.exports = {
   },
   devServer: {
     inline: true,
-    port: 8080
+    port: 8080,
+    historyApiFallback: true,
+    proxy: {
+      "/login": "http://localhost:80",
+      "/oauth": "http://localhost:80",
+      "/password": "http://localhost:80"
+    }
     },
   module: {
     rules: [